@@ -9,7 +9,7 @@ import (
 )
 
 type Config struct {
-	Port    int
+	Port    int `default:"5000" min:"1" max:"65535"`
 	Tracing TracingConfig
 }
 
@@ -22,9 +22,7 @@ type JaegerConfig struct {
 	URL string
 }
 
-var cfg *Config = &Config{
-	Port: 5000,
-}
+var cfg *Config = &Config{}
 
 func Address() string {
 	return fmt.Sprintf(":%d", cfg.Port)
@@ -0,0 +1,14 @@
+package broker_test
+
+import (
+	"testing"
+
+	"github.com/wxc/micro/broker"
+	"github.com/wxc/micro/broker/test"
+)
+
+func TestTestBroker(t *testing.T) {
+	test.Run(t, func(t testing.TB) broker.Broker {
+		return broker.NewTestBroker()
+	})
+}
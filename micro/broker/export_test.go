@@ -0,0 +1,6 @@
+package broker
+
+// NewTestBroker exposes the in process test broker to the broker_test package
+func NewTestBroker() Broker {
+	return newTestBroker()
+}
@@ -1,13 +1,17 @@
 package broker
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -16,7 +20,8 @@ import (
 	merr "github.com/wxc/micro/errors"
 	"github.com/wxc/micro/registry"
 	"github.com/wxc/micro/registry/cache"
-	"go-micro.dev/v4/transport/headers"
+	"github.com/wxc/micro/transport/headers"
+	"go-micro.dev/v4/logger"
 	"golang.org/x/net/http2"
 )
 
@@ -31,7 +36,7 @@ type httpBroker struct {
 	subscribers map[string][]*httpSubscriber
 	exit        chan chan error
 
-	inbox   map[string][][]byte
+	inbox   map[string][]*httpFrame
 	id      string
 	address string
 
@@ -40,6 +45,16 @@ type httpBroker struct {
 	// offline message inbox
 	mtx     sync.RWMutex
 	running bool
+
+	// pending batches by topic and partition key
+	bmtx    sync.Mutex
+	batches map[string]*httpBatch
+	// keyed batches detached but not yet sent, oldest first
+	sending map[string][]*httpBatch
+
+	// partition keys being published and handled
+	pkeys keyMutex
+	skeys keyMutex
 }
 
 type httpSubscriber struct {
@@ -57,6 +72,21 @@ type httpEvent struct {
 	t   string
 }
 
+// httpFrame is the body of a single POST along with how it was encoded
+type httpFrame struct {
+	body     []byte
+	encoding string
+	batch    int
+	key      string
+}
+
+type httpBatch struct {
+	topic    string
+	opts     PublishOptions
+	messages []*Message
+	timer    *time.Timer
+}
+
 var (
 	DefaultPath      = "/"
 	DefaultAddress   = "127.0.0.1:0"
@@ -64,6 +94,11 @@ var (
 	broadcastVersion = "ff.http.broadcast"
 	registerTTL      = time.Minute
 	registerInterval = time.Second * 30
+
+	DefaultBatchLinger = 100 * time.Millisecond
+	// DefaultMaxBodySize is the largest request body accepted, before
+	// and after it is decompressed
+	DefaultMaxBodySize int64 = 32 << 20
 )
 
 func init() {
@@ -101,11 +136,11 @@ func newTransport(config *tls.Config) *http.Transport {
 func newHttpBroker(opts ...Option) Broker {
 	options := *NewOptions(opts...)
 
-	options.Registry = registry.DefaultRegistry
-	options.Codec = json.Marshaler{}
-
-	for _, o := range opts {
-		o(&options)
+	if options.Registry == nil {
+		options.Registry = registry.DefaultRegistry
+	}
+	if options.Codec == nil {
+		options.Codec = json.Marshaler{}
 	}
 
 	addr := DefaultAddress
@@ -123,7 +158,9 @@ func newHttpBroker(opts ...Option) Broker {
 		subscribers: make(map[string][]*httpSubscriber),
 		exit:        make(chan chan error),
 		mux:         http.NewServeMux(),
-		inbox:       make(map[string][][]byte),
+		inbox:       make(map[string][]*httpFrame),
+		batches:     make(map[string]*httpBatch),
+		sending:     make(map[string][]*httpBatch),
 	}
 	h.mux.Handle(DefaultPath, h)
 
@@ -166,12 +203,12 @@ func (h *httpSubscriber) Unsubscribe() error {
 	return h.hb.unsubscribe(h)
 }
 
-func (h *httpBroker) saveMessage(topic string, msg []byte) {
+func (h *httpBroker) saveMessage(topic string, f *httpFrame) {
 	h.mtx.Lock()
 	defer h.mtx.Unlock()
 
 	c := h.inbox[topic]
-	c = append(c, msg)
+	c = append(c, f)
 	if len(c) > 64 {
 		c = c[:64]
 	}
@@ -179,7 +216,7 @@ func (h *httpBroker) saveMessage(topic string, msg []byte) {
 	h.inbox[topic] = c
 }
 
-func (h *httpBroker) getMessage(topic string, num int) [][]byte {
+func (h *httpBroker) getMessage(topic string, num int) []*httpFrame {
 	h.mtx.Lock()
 	defer h.mtx.Unlock()
 
@@ -267,7 +304,13 @@ func (h *httpBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	req.ParseForm()
 
-	b, err := io.ReadAll(req.Body)
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, DefaultMaxBodySize))
+	if _, ok := err.(*http.MaxBytesError); ok {
+		errr := merr.New("go.micro.broker", "Request body too large", http.StatusRequestEntityTooLarge)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(errr.Error()))
+		return
+	}
 	if err != nil {
 		errr := merr.InternalServerError("go.micro.broker", "Error reading request body: %v", err)
 		w.WriteHeader(500)
@@ -275,37 +318,68 @@ func (h *httpBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var m *Message
-	if err = h.opts.Codec.Unmarshal(b, &m); err != nil {
+	if enc := req.Header.Get(headers.ContentEncoding); len(enc) > 0 {
+		if b, err = decompress(enc, b, DefaultMaxBodySize); err != nil {
+			errr := merr.BadRequest("go.micro.broker", "Error decoding request body: %v", err)
+			w.WriteHeader(400)
+			w.Write([]byte(errr.Error()))
+			return
+		}
+	}
+
+	// a batched frame carries several messages
+	var msgs []*Message
+	if len(req.Header.Get(headers.Batch)) > 0 {
+		err = h.opts.Codec.Unmarshal(b, &msgs)
+	} else {
+		var m *Message
+		err = h.opts.Codec.Unmarshal(b, &m)
+		msgs = []*Message{m}
+	}
+	if err != nil {
 		errr := merr.InternalServerError("go.micro.broker", "Error parsing request body: %v", err)
 		w.WriteHeader(500)
 		w.Write([]byte(errr.Error()))
 		return
 	}
 
-	topic := m.Header[headers.Message]
-	if len(topic) == 0 {
-		errr := merr.InternalServerError("go.micro.broker", "Topic not found")
-		w.WriteHeader(500)
-		w.Write([]byte(errr.Error()))
-		return
+	for _, m := range msgs {
+		if m == nil || len(m.Header[headers.Message]) == 0 {
+			errr := merr.InternalServerError("go.micro.broker", "Topic not found")
+			w.WriteHeader(500)
+			w.Write([]byte(errr.Error()))
+			return
+		}
 	}
 
-	p := &httpEvent{m: m, t: topic}
 	id := req.Form.Get("id")
-	var subs []Handler
 
-	h.RLock()
-	for _, subscriber := range h.subscribers[topic] {
-		if id != subscriber.id {
-			continue
-		}
-		subs = append(subs, subscriber.fn)
-	}
-	h.RUnlock()
+	for _, m := range msgs {
+		func() {
+			topic := m.Header[headers.Message]
+			p := &httpEvent{m: m, t: topic}
+			var subs []Handler
+
+			// handle one message per partition key at a time, releasing
+			// the key even if a handler panics
+			if key := m.Header[headers.PartitionKey]; len(key) > 0 {
+				h.skeys.Lock(partition(topic, key))
+				defer h.skeys.Unlock(partition(topic, key))
+			}
+
+			h.RLock()
+			for _, subscriber := range h.subscribers[topic] {
+				if id != subscriber.id {
+					continue
+				}
+				subs = append(subs, subscriber.fn)
+			}
+			h.RUnlock()
 
-	for _, fn := range subs {
-		p.err = fn(p)
+			for _, fn := range subs {
+				p.err = fn(p)
+			}
+		}()
 	}
 }
 
@@ -371,7 +445,278 @@ func (h *httpBroker) Options() Options {
 }
 
 func (h *httpBroker) Publish(topic string, msg *Message, opts ...PublishOption) error {
-	panic("in Publish")
+	if msg == nil {
+		return merr.BadRequest("go.micro.broker", "publish to %s has no message", topic)
+	}
+
+	options := NewPublishOptions(opts...)
+
+	// create the message first
+	m := &Message{
+		Header: make(map[string]string),
+		Body:   msg.Body,
+	}
+
+	for k, v := range msg.Header {
+		m.Header[k] = v
+	}
+
+	m.Header[headers.Message] = topic
+
+	if len(options.PartitionKey) > 0 {
+		m.Header[headers.PartitionKey] = options.PartitionKey
+	}
+
+	if options.BatchSize > 1 {
+		return h.batch(topic, m, options)
+	}
+
+	// encode the message
+	b, err := h.opts.Codec.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if b, err = compress(options.Compression, b); err != nil {
+		return err
+	}
+
+	return h.publish(topic, &httpFrame{
+		body:     b,
+		encoding: options.Compression,
+		key:      options.PartitionKey,
+	})
+}
+
+// batch queues the message and flushes once the batch is full. The first
+// message of a batch arms the linger timer. A message published with
+// other options than the pending batch flushes that batch first, so the
+// options apply and the order is kept.
+func (h *httpBroker) batch(topic string, m *Message, opts PublishOptions) error {
+	key := partition(topic, opts.PartitionKey)
+
+	h.bmtx.Lock()
+	bt, ok := h.batches[key]
+	if ok && (bt.opts.Compression != opts.Compression || bt.opts.BatchSize != opts.BatchSize || bt.opts.BatchLinger != opts.BatchLinger) {
+		h.bmtx.Unlock()
+		if err := h.flush(key, bt); err != nil {
+			return err
+		}
+		return h.batch(topic, m, opts)
+	}
+	if !ok {
+		bt = &httpBatch{topic: topic, opts: opts}
+		bt.timer = time.AfterFunc(opts.BatchLinger, func() {
+			if err := h.flush(key, bt); err != nil {
+				h.opts.Logger.Logf(logger.ErrorLevel, "Failed to flush batch for topic %s: %v", topic, err)
+			}
+		})
+		h.batches[key] = bt
+	}
+	bt.messages = append(bt.messages, m)
+	full := len(bt.messages) >= bt.opts.BatchSize
+	h.bmtx.Unlock()
+
+	if !full {
+		return nil
+	}
+
+	return h.flush(key, bt)
+}
+
+func (h *httpBroker) flush(key string, bt *httpBatch) error {
+	h.bmtx.Lock()
+	// already flushed by the timer or a full batch
+	if h.batches[key] != bt {
+		h.bmtx.Unlock()
+		return nil
+	}
+	delete(h.batches, key)
+	bt.timer.Stop()
+
+	keyed := len(bt.opts.PartitionKey) > 0
+	if keyed {
+		h.sending[key] = append(h.sending[key], bt)
+	}
+	h.bmtx.Unlock()
+
+	// hold the partition until the frame is sent and send the oldest
+	// batch detached for it, so the next batch for the same key cannot
+	// overtake it while other topics carry on
+	if keyed {
+		h.pkeys.Lock(key)
+		defer h.pkeys.Unlock(key)
+
+		h.bmtx.Lock()
+		bt = h.sending[key][0]
+		if q := h.sending[key][1:]; len(q) > 0 {
+			h.sending[key] = q
+		} else {
+			delete(h.sending, key)
+		}
+		h.bmtx.Unlock()
+	}
+
+	b, err := h.opts.Codec.Marshal(bt.messages)
+	if err != nil {
+		return err
+	}
+
+	if b, err = compress(bt.opts.Compression, b); err != nil {
+		return err
+	}
+
+	return h.publish(bt.topic, &httpFrame{
+		body:     b,
+		encoding: bt.opts.Compression,
+		batch:    len(bt.messages),
+		key:      bt.opts.PartitionKey,
+	})
+}
+
+func (h *httpBroker) publish(topic string, f *httpFrame) error {
+	// keyed frames are sent in order and never parked in the inbox
+	// since replaying them later would reorder the partition
+	if len(f.key) == 0 {
+		// save the message
+		h.saveMessage(topic, f)
+	}
+
+	// now attempt to get the service
+	h.RLock()
+	s, err := h.r.GetService(serviceName)
+	if err != nil {
+		h.RUnlock()
+		return err
+	}
+	h.RUnlock()
+
+	pub := func(node *registry.Node, t string, f *httpFrame) error {
+		scheme := "http"
+
+		// check if secure is added in metadata
+		if node.Metadata["secure"] == "true" {
+			scheme = "https"
+		}
+
+		vals := url.Values{}
+		vals.Add("id", node.Id)
+
+		uri := fmt.Sprintf("%s://%s%s?%s", scheme, node.Address, DefaultPath, vals.Encode())
+		req, err := http.NewRequest("POST", uri, bytes.NewReader(f.body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set(headers.ContentType, "application/json")
+		if len(f.encoding) > 0 {
+			req.Header.Set(headers.ContentEncoding, f.encoding)
+		}
+		if f.batch > 0 {
+			req.Header.Set(headers.Batch, strconv.Itoa(f.batch))
+		}
+
+		r, err := h.c.Do(req)
+		if err != nil {
+			return err
+		}
+
+		// discard response body
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+		return nil
+	}
+
+	srv := func(s []*registry.Service, f *httpFrame) error {
+		var lastErr error
+
+		for _, service := range s {
+			var nodes []*registry.Node
+
+			for _, node := range service.Nodes {
+				// only use nodes tagged with broker http
+				if node.Metadata["broker"] != "http" {
+					continue
+				}
+
+				// look for nodes for the topic
+				if node.Metadata["topic"] != topic {
+					continue
+				}
+
+				nodes = append(nodes, node)
+			}
+
+			// only process if we have nodes
+			if len(nodes) == 0 {
+				continue
+			}
+
+			switch service.Version {
+			// broadcast version means broadcast to all nodes
+			case broadcastVersion:
+				var success bool
+
+				// publish to all nodes
+				for _, node := range nodes {
+					if err := pub(node, topic, f); err != nil {
+						lastErr = err
+					} else {
+						success = true
+					}
+				}
+
+				// save if it failed to publish at least once
+				if !success && len(f.key) == 0 {
+					h.saveMessage(topic, f)
+				}
+			default:
+				// select node to publish to, a partition
+				// key always lands on the same node
+				var node *registry.Node
+				if len(f.key) > 0 {
+					node = selectNode(f.key, nodes)
+				} else {
+					node = nodes[rand.Int()%len(nodes)]
+				}
+
+				// publish to one node
+				if err := pub(node, topic, f); err != nil {
+					lastErr = err
+					// if failed save it
+					if len(f.key) == 0 {
+						h.saveMessage(topic, f)
+					}
+				}
+			}
+		}
+
+		return lastErr
+	}
+
+	if len(f.key) > 0 {
+		return srv(s, f)
+	}
+
+	// do the rest async
+	go func() {
+		// get a third of the backlog
+		frames := h.getMessage(topic, 8)
+		delay := (len(frames) > 1)
+
+		// publish all the messages
+		for _, f := range frames {
+			// serialize here
+			_ = srv(s, f)
+
+			// sending a backlog of messages
+			if delay {
+				time.Sleep(time.Millisecond * 100)
+			}
+		}
+	}()
+
+	return nil
 }
 
 func (h *httpBroker) Subscribe(topic string, handler Handler, opts ...SubscribeOption) (Subscriber, error) {
@@ -383,5 +728,5 @@ func (h *httpBroker) String() string {
 }
 
 func NewBroker(opts ...Option) Broker {
-	return newHttpBroker(opts...)
+	return Wrap(newHttpBroker(opts...))
 }
@@ -0,0 +1,333 @@
+package broker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/registry"
+)
+
+// newTestSubscriber serves a broker over httptest and registers a handler
+// for the topic without going through Connect.
+func newTestSubscriber(t *testing.T, r registry.Registry, topic, queue string, fn Handler) *httpBroker {
+	h := newHttpBroker(Registry(r)).(*httpBroker)
+	srv := httptest.NewServer(h.mux)
+	t.Cleanup(srv.Close)
+
+	node := &registry.Node{
+		Id:      topic + "-" + h.id,
+		Address: srv.Listener.Addr().String(),
+		Metadata: map[string]string{
+			"broker": "http",
+			"topic":  topic,
+		},
+	}
+
+	version := queue
+	if len(version) == 0 {
+		version = broadcastVersion
+	}
+
+	sub := &httpSubscriber{
+		opts:  NewSubscribeOptions(Queue(queue)),
+		fn:    fn,
+		hb:    h,
+		id:    node.Id,
+		topic: topic,
+		svc: &registry.Service{
+			Name:    serviceName,
+			Version: version,
+			Nodes:   []*registry.Node{node},
+		},
+	}
+
+	if err := h.subscribe(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestHttpBroker_PublishBatch(t *testing.T) {
+	for _, enc := range []string{"", Gzip, Snappy, Zstd} {
+		r := registry.NewMemoryRegistry()
+
+		var mtx sync.Mutex
+		var bodies []string
+		done := make(chan bool)
+
+		newTestSubscriber(t, r, "test", "", func(e Event) error {
+			mtx.Lock()
+			defer mtx.Unlock()
+			bodies = append(bodies, string(e.Message().Body))
+			if len(bodies) == 3 {
+				close(done)
+			}
+			return nil
+		})
+
+		pub := newHttpBroker(Registry(r))
+		for _, body := range []string{"a", "b", "c"} {
+			msg := &Message{Header: map[string]string{"foo": "bar"}, Body: []byte(body)}
+			if err := pub.Publish("test", msg, Batch(3, time.Minute), Compress(enc)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("%q: timed out waiting for batch", enc)
+		}
+
+		if bodies[0] != "a" || bodies[1] != "b" || bodies[2] != "c" {
+			t.Fatalf("%q: unexpected bodies %v", enc, bodies)
+		}
+	}
+}
+
+func TestHttpBroker_PublishLinger(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	done := make(chan *Message, 1)
+
+	newTestSubscriber(t, r, "test", "", func(e Event) error {
+		done <- e.Message()
+		return nil
+	})
+
+	pub := newHttpBroker(Registry(r))
+	msg := &Message{Body: []byte("linger")}
+	if err := pub.Publish("test", msg, Batch(10, time.Millisecond*50), Compress(Gzip)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-done:
+		if string(m.Body) != "linger" {
+			t.Fatalf("unexpected body %s", m.Body)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("batch was not flushed after linger")
+	}
+}
+
+func TestHttpBroker_PublishPartitionKey(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	// partition key -> subscribers that saw it
+	owners := make(map[string]map[string]bool)
+	// partition key -> bodies in the order they were handled
+	seen := make(map[string][]string)
+
+	for i := 0; i < 3; i++ {
+		var h *httpBroker
+		h = newTestSubscriber(t, r, "orders", "workers", func(e Event) error {
+			key := e.Message().Header["Micro-Partition-Key"]
+			mtx.Lock()
+			if owners[key] == nil {
+				owners[key] = make(map[string]bool)
+			}
+			owners[key][h.id] = true
+			seen[key] = append(seen[key], string(e.Message().Body))
+			mtx.Unlock()
+			wg.Done()
+			return nil
+		})
+	}
+
+	pub := newHttpBroker(Registry(r))
+	keys := []string{"order-1", "order-2", "order-3", "order-4"}
+
+	for i := 0; i < 10; i++ {
+		for _, key := range keys {
+			wg.Add(1)
+			msg := &Message{Body: []byte{byte('0' + i)}}
+			if err := pub.Publish("orders", msg, PartitionKey(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	wg.Wait()
+
+	for _, key := range keys {
+		if len(owners[key]) != 1 {
+			t.Fatalf("key %s was handled by %d subscribers", key, len(owners[key]))
+		}
+		for i, body := range seen[key] {
+			if body != string(byte('0'+i)) {
+				t.Fatalf("key %s handled out of order: %v", key, seen[key])
+			}
+		}
+	}
+}
+
+func TestHttpBroker_FlushDoesNotBlockPublish(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+
+	release := make(chan bool)
+	handled := make(chan string, 10)
+	newTestSubscriber(t, r, "slow", "", func(e Event) error {
+		handled <- string(e.Message().Body)
+		<-release
+		return nil
+	})
+
+	pub := newHttpBroker(Registry(r))
+	opts := []PublishOption{PartitionKey("k"), Batch(1<<10, time.Millisecond)}
+
+	// one keyed batch is held by the subscriber, the next waits for it
+	if err := pub.Publish("slow", &Message{Body: []byte("1")}, opts...); err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	if err := pub.Publish("slow", &Message{Body: []byte("2")}, opts...); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pub.Publish("other", &Message{Body: []byte("x")}, Batch(2, time.Hour))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatal("publish to another topic blocked on a keyed flush")
+	}
+
+	close(release)
+	if body := <-handled; body != "2" {
+		t.Fatalf("expected 2 got %s", body)
+	}
+}
+
+func TestHttpBroker_Options(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	noop := func(fn PublishFunc) PublishFunc { return fn }
+
+	opts := newHttpBroker(Registry(r), WrapPublish(noop)).Options()
+	if opts.Registry != r {
+		t.Fatal("registry option was not applied")
+	}
+	if len(opts.PublishWrappers) != 1 {
+		t.Fatalf("expected 1 publish wrapper got %d", len(opts.PublishWrappers))
+	}
+}
+
+func TestHttpBroker_BatchOptions(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	done := make(chan string, 4)
+
+	newTestSubscriber(t, r, "test", "", func(e Event) error {
+		done <- string(e.Message().Body)
+		return nil
+	})
+
+	pub := newHttpBroker(Registry(r))
+	if err := pub.Publish("test", &Message{Body: []byte("a")}, Batch(3, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// other options flush the pending batch rather than joining it
+	for _, body := range []string{"b", "c", "d"} {
+		if err := pub.Publish("test", &Message{Body: []byte(body)}, Batch(3, time.Hour), Compress(Gzip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expect := range []string{"a", "b", "c", "d"} {
+		select {
+		case body := <-done:
+			if body != expect {
+				t.Fatalf("expected %s got %s", expect, body)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for %s", expect)
+		}
+	}
+}
+
+func TestHttpBroker_BodyLimit(t *testing.T) {
+	max := DefaultMaxBodySize
+	DefaultMaxBodySize = 1 << 10
+	defer func() { DefaultMaxBodySize = max }()
+
+	h := newHttpBroker().(*httpBroker)
+
+	big := bytes.Repeat([]byte("a"), 4<<10)
+	zipped, err := compress(Gzip, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		body     []byte
+		encoding string
+		code     int
+	}{
+		{big, "", http.StatusRequestEntityTooLarge},
+		{zipped, Gzip, http.StatusBadRequest},
+	}
+
+	for _, d := range testData {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(d.body))
+		if len(d.encoding) > 0 {
+			req.Header.Set("Content-Encoding", d.encoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != d.code {
+			t.Fatalf("%q: expected %d got %d", d.encoding, d.code, rec.Code)
+		}
+	}
+}
+
+func TestHttpBroker_PublishNil(t *testing.T) {
+	h := newHttpBroker()
+	if err := h.Publish("test", nil); err == nil {
+		t.Fatal("expected an error publishing a nil message")
+	}
+}
+
+func TestHttpBroker_PartitionKeyPanic(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	done := make(chan string, 2)
+
+	newTestSubscriber(t, r, "orders", "workers", func(e Event) error {
+		body := string(e.Message().Body)
+		if body == "panic" {
+			panic(body)
+		}
+		done <- body
+		return nil
+	})
+
+	pub := newHttpBroker(Registry(r))
+	// the server recovers the panic and the key must not stay locked
+	pub.Publish("orders", &Message{Body: []byte("panic")}, PartitionKey("order-1"))
+
+	if err := pub.Publish("orders", &Message{Body: []byte("ok")}, PartitionKey("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case body := <-done:
+		if body != "ok" {
+			t.Fatalf("expected ok got %s", body)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("partition key is still locked after a handler panic")
+	}
+}
@@ -3,6 +3,7 @@ package broker
 import (
 	"context"
 	"crypto/tls"
+	"time"
 
 	"github.com/wxc/micro/registry"
 	"go-micro.dev/v4/codec"
@@ -18,10 +19,22 @@ type Options struct {
 	TLSConfig    *tls.Config
 	Addrs        []string
 	Secure       bool
+
+	PublishWrappers    []PublishWrapper
+	SubscriberWrappers []SubscriberWrapper
 }
 
 type PublishOptions struct {
 	Context context.Context
+	// Content-Encoding used to compress the transport frame
+	Compression string
+	// flush the batch once it holds BatchSize messages
+	BatchSize int
+	// or once BatchLinger has elapsed since the first message
+	BatchLinger time.Duration
+	// messages with the same key are delivered to one member
+	// of a queue group and handled in order
+	PartitionKey string
 }
 
 type SubscribeOptions struct {
@@ -40,6 +53,33 @@ func PublishContext(ctx context.Context) PublishOption {
 	}
 }
 
+// Batch groups up to size messages of a topic into one transport frame,
+// flushing whatever is queued after linger.
+func Batch(size int, linger time.Duration) PublishOption {
+	return func(o *PublishOptions) {
+		o.BatchSize = size
+		o.BatchLinger = linger
+	}
+}
+
+// Compress sets the Content-Encoding (gzip, snappy or zstd) of the frame.
+func Compress(encoding string) PublishOption {
+	return func(o *PublishOptions) {
+		o.Compression = encoding
+	}
+}
+
+// PartitionKey routes every message with the same key to the same
+// subscriber of a queue group, where they are handled one at a time.
+// Keyed messages skip the outbox so a failed send is never saved or
+// retried: it is returned from Publish, or only logged when a lingering
+// batch is flushed by its timer. Callers that resend may reorder the key.
+func PartitionKey(key string) PublishOption {
+	return func(o *PublishOptions) {
+		o.PartitionKey = key
+	}
+}
+
 type SubscribeOption func(*SubscribeOptions)
 
 func NewOptions(opts ...Option) *Options {
@@ -55,6 +95,22 @@ func NewOptions(opts ...Option) *Options {
 	return &options
 }
 
+func NewPublishOptions(opts ...PublishOption) PublishOptions {
+	opt := PublishOptions{
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if opt.BatchSize > 1 && opt.BatchLinger <= 0 {
+		opt.BatchLinger = DefaultBatchLinger
+	}
+
+	return opt
+}
+
 func NewSubscribeOptions(opts ...SubscribeOption) SubscribeOptions {
 	opt := SubscribeOptions{
 		AutoAck: true,
@@ -121,6 +177,18 @@ func Logger(l logger.Logger) Option {
 	}
 }
 
+func WrapPublish(w ...PublishWrapper) Option {
+	return func(o *Options) {
+		o.PublishWrappers = append(o.PublishWrappers, w...)
+	}
+}
+
+func WrapSubscriber(w ...SubscriberWrapper) Option {
+	return func(o *Options) {
+		o.SubscriberWrappers = append(o.SubscriberWrappers, w...)
+	}
+}
+
 func SubscribeContext(ctx context.Context) SubscribeOption {
 	return func(o *SubscribeOptions) {
 		o.Context = ctx
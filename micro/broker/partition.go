@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/wxc/micro/registry"
+)
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// keyMutex serializes work per key, dropping locks no one holds
+type keyMutex struct {
+	sync.Mutex
+	locks map[string]*keyLock
+}
+
+func (k *keyMutex) Lock(key string) {
+	k.Mutex.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.Mutex.Unlock()
+
+	l.Lock()
+}
+
+func (k *keyMutex) Unlock(key string) {
+	k.Mutex.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		k.Mutex.Unlock()
+		return
+	}
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+	k.Mutex.Unlock()
+
+	l.Unlock()
+}
+
+// partition scopes a key to its topic
+func partition(topic, key string) string {
+	if len(key) == 0 {
+		return topic
+	}
+	return topic + "\x00" + key
+}
+
+// selectNode picks the node for a partition key using rendezvous hashing
+// so a key only moves when the node that owns it goes away.
+func selectNode(key string, nodes []*registry.Node) *registry.Node {
+	var node *registry.Node
+	var max uint64
+
+	for _, n := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(n.Id))
+		if sum := h.Sum64(); node == nil || sum > max {
+			node = n
+			max = sum
+		}
+	}
+
+	return node
+}
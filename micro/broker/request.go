@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/transport/headers"
+)
+
+// Requester publishes requests and waits for the matching reply on a
+// private inbox topic.
+type Requester interface {
+	Request(ctx context.Context, topic string, msg *Message, opts ...PublishOption) (*Message, error)
+	Close() error
+}
+
+// RequestHandler answers a request, a returned error is sent back to the
+// requester as an errors.Error.
+type RequestHandler func(Event) (*Message, error)
+
+var (
+	DefaultRequestTimeout = time.Second * 30
+	inboxPrefix           = "_inbox."
+)
+
+type requester struct {
+	b     Broker
+	inbox string
+
+	sync.Mutex
+	sub     Subscriber
+	pending map[string]chan *Message
+}
+
+func (r *requester) handle(e Event) error {
+	m := e.Message()
+	id := m.Header[headers.CorrelationID]
+
+	r.Lock()
+	ch, ok := r.pending[id]
+	delete(r.pending, id)
+	r.Unlock()
+
+	// late reply for a request that already gave up
+	if !ok {
+		return nil
+	}
+
+	ch <- m
+	return nil
+}
+
+func (r *requester) Request(ctx context.Context, topic string, msg *Message, opts ...PublishOption) (*Message, error) {
+	if msg == nil {
+		return nil, merr.BadRequest("go.micro.broker", "request to %s has no message", topic)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	id := uuid.New().String()
+	ch := make(chan *Message, 1)
+
+	r.Lock()
+	// subscribe to the inbox on first use
+	if r.sub == nil {
+		sub, err := r.b.Subscribe(r.inbox, r.handle)
+		if err != nil {
+			r.Unlock()
+			return nil, err
+		}
+		r.sub = sub
+	}
+	r.pending[id] = ch
+	r.Unlock()
+
+	defer func() {
+		r.Lock()
+		delete(r.pending, id)
+		r.Unlock()
+	}()
+
+	m := &Message{
+		Header: make(map[string]string),
+		Body:   msg.Body,
+	}
+
+	for k, v := range msg.Header {
+		m.Header[k] = v
+	}
+
+	m.Header[headers.ReplyTo] = r.inbox
+	m.Header[headers.CorrelationID] = id
+
+	opts = append(opts, PublishContext(ctx))
+	if err := r.b.Publish(topic, m, opts...); err != nil {
+		return nil, err
+	}
+
+	select {
+	case rsp := <-ch:
+		if e := rsp.Header[headers.Error]; len(e) > 0 {
+			return nil, merr.Parse(e)
+		}
+		return rsp, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, merr.Timeout("go.micro.broker", "request %s to %s timed out", id, topic)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (r *requester) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.sub == nil {
+		return nil
+	}
+
+	err := r.sub.Unsubscribe()
+	r.sub = nil
+	return err
+}
+
+func NewRequester(b Broker) Requester {
+	return &requester{
+		b:       b,
+		inbox:   inboxPrefix + uuid.New().String(),
+		pending: make(map[string]chan *Message),
+	}
+}
+
+// ReplyHandler turns fn into a Handler that publishes its answer to the
+// reply topic of the request. Messages without a reply topic are handled
+// as plain events.
+func ReplyHandler(b Broker, fn RequestHandler) Handler {
+	return func(e Event) error {
+		m := e.Message()
+		rsp, err := fn(e)
+
+		replyTo := m.Header[headers.ReplyTo]
+		if len(replyTo) == 0 {
+			return err
+		}
+
+		reply := &Message{
+			Header: make(map[string]string),
+		}
+
+		if err != nil {
+			if _, ok := merr.As(err); !ok {
+				err = merr.InternalServerError("go.micro.broker", "%v", err)
+			}
+			reply.Header[headers.Error] = err.Error()
+		} else if rsp != nil {
+			for k, v := range rsp.Header {
+				reply.Header[k] = v
+			}
+			reply.Body = rsp.Body
+		}
+
+		reply.Header[headers.CorrelationID] = m.Header[headers.CorrelationID]
+
+		return b.Publish(replyTo, reply)
+	}
+}
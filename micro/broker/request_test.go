@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	merr "github.com/wxc/micro/errors"
+)
+
+// testBroker delivers messages in process to every subscriber of a
+// topic, and to one member of each queue group
+type testBroker struct {
+	opts Options
+
+	sync.RWMutex
+	subs map[string][]*testSubscriber
+}
+
+type testSubscriber struct {
+	b     *testBroker
+	topic string
+	fn    Handler
+	opts  SubscribeOptions
+}
+
+type testEvent struct {
+	topic string
+	m     *Message
+}
+
+func newTestBroker(opts ...Option) *testBroker {
+	return &testBroker{
+		opts: *NewOptions(opts...),
+		subs: make(map[string][]*testSubscriber),
+	}
+}
+
+func (e *testEvent) Topic() string     { return e.topic }
+func (e *testEvent) Message() *Message { return e.m }
+func (e *testEvent) Ack() error        { return nil }
+func (e *testEvent) Error() error      { return nil }
+
+func (s *testSubscriber) Options() SubscribeOptions { return s.opts }
+func (s *testSubscriber) Topic() string             { return s.topic }
+
+func (s *testSubscriber) Unsubscribe() error {
+	s.b.Lock()
+	defer s.b.Unlock()
+
+	var subs []*testSubscriber
+	for _, sub := range s.b.subs[s.topic] {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+	s.b.subs[s.topic] = subs
+	return nil
+}
+
+func (b *testBroker) Options() Options  { return b.opts }
+func (b *testBroker) Address() string   { return "" }
+func (b *testBroker) Connect() error    { return nil }
+func (b *testBroker) Disconnect() error { return nil }
+func (b *testBroker) String() string    { return "test" }
+
+func (b *testBroker) Init(opts ...Option) error {
+	for _, o := range opts {
+		o(&b.opts)
+	}
+	return nil
+}
+
+func (b *testBroker) Publish(topic string, m *Message, opts ...PublishOption) error {
+	b.RLock()
+	subs := b.subs[topic]
+	b.RUnlock()
+
+	groups := make(map[string][]*testSubscriber)
+	for _, sub := range subs {
+		if len(sub.opts.Queue) > 0 {
+			groups[sub.opts.Queue] = append(groups[sub.opts.Queue], sub)
+			continue
+		}
+		go sub.fn(&testEvent{topic: topic, m: m})
+	}
+	for _, group := range groups {
+		sub := group[rand.Intn(len(group))]
+		go sub.fn(&testEvent{topic: topic, m: m})
+	}
+	return nil
+}
+
+func (b *testBroker) Subscribe(topic string, h Handler, opts ...SubscribeOption) (Subscriber, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	sub := &testSubscriber{b: b, topic: topic, fn: h, opts: NewSubscribeOptions(opts...)}
+	b.subs[topic] = append(b.subs[topic], sub)
+	return sub, nil
+}
+
+func TestRequester(t *testing.T) {
+	b := newTestBroker()
+
+	_, err := b.Subscribe("greeter", ReplyHandler(b, func(e Event) (*Message, error) {
+		name := string(e.Message().Body)
+		switch name {
+		case "":
+			return nil, merr.BadRequest("greeter", "name is required")
+		case "boom":
+			return nil, errors.New("boom")
+		case "slow":
+			time.Sleep(time.Second)
+		}
+		return &Message{Body: []byte("hello " + name)}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRequester(b)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err := r.Request(ctx, "greeter", nil); err == nil {
+		t.Fatal("expected an error for a nil message")
+	}
+
+	rsp, err := r.Request(ctx, "greeter", &Message{Body: []byte("john")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rsp.Body) != "hello john" {
+		t.Fatalf("unexpected reply %s", rsp.Body)
+	}
+
+	_, err = r.Request(ctx, "greeter", &Message{})
+	if e, ok := merr.As(err); !ok || e.Code != 400 || e.Detail != "name is required" {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+
+	_, err = r.Request(ctx, "greeter", &Message{Body: []byte("boom")})
+	if e, ok := merr.As(err); !ok || e.Code != 500 || e.Detail != "boom" {
+		t.Fatalf("expected internal server error, got %v", err)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err = r.Request(short, "greeter", &Message{Body: []byte("slow")})
+	if e, ok := merr.As(err); !ok || e.Code != 408 {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/broker"
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+)
+
+type Options struct {
+	// Store keeps pending messages across restarts
+	Store    store.Store
+	Database string
+	Table    string
+	// RetryInterval is the wait before a failed delivery is retried
+	RetryInterval time.Duration
+	Logger        logger.Logger
+}
+
+type Option func(o *Options)
+
+type deliverAtKey struct{}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		Store:         store.DefaultStore,
+		Table:         "schedule",
+		RetryInterval: time.Second * 10,
+		Logger:        logger.DefaultLogger,
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return options
+}
+
+func WithStore(s store.Store) Option {
+	return func(o *Options) {
+		o.Store = s
+	}
+}
+
+func Database(db string) Option {
+	return func(o *Options) {
+		o.Database = db
+	}
+}
+
+func Table(t string) Option {
+	return func(o *Options) {
+		o.Table = t
+	}
+}
+
+func RetryInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.RetryInterval = d
+	}
+}
+
+func WithLogger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// DeliverAt holds the message until t.
+func DeliverAt(t time.Time) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, deliverAtKey{}, t)
+	}
+}
+
+// DeliverAfter holds the message for d.
+func DeliverAfter(d time.Duration) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, deliverAtKey{}, time.Now().Add(d))
+	}
+}
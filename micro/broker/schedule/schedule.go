@@ -0,0 +1,375 @@
+package schedule
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wxc/micro/broker"
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/transport/headers"
+)
+
+var (
+	ErrNotFound = errors.New("scheduled message not found")
+	ErrTooLate  = errors.New("scheduled message is already being delivered")
+)
+
+// Broker is a broker.Broker which holds messages published with DeliverAt
+// or DeliverAfter until they are due.
+type Broker interface {
+	broker.Broker
+	// Schedule holds msg until at and returns the id to cancel it with,
+	// the Micro-ID header if set or a generated one
+	Schedule(topic string, msg *broker.Message, at time.Time, opts ...broker.PublishOption) (string, error)
+	// Cancel drops a pending message by its Micro-ID header
+	Cancel(id string) error
+}
+
+type scheduleBroker struct {
+	broker.Broker
+
+	opts Options
+
+	sync.Mutex
+	queue   messageQueue
+	pending map[string]*message
+	// messages popped by due and not yet delivered or requeued
+	delivering map[string]bool
+	wake       chan bool
+	exit       chan bool
+}
+
+// message is the persisted form of a scheduled message
+type message struct {
+	ID      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Message *broker.Message `json:"message"`
+	At      time.Time       `json:"at"`
+	Options *publishOptions `json:"options,omitempty"`
+
+	index int
+}
+
+// publishOptions are the broker.PublishOptions replayed on delivery,
+// values in the Context can't be persisted and are dropped
+type publishOptions struct {
+	Compression  string        `json:"compression,omitempty"`
+	BatchSize    int           `json:"batch_size,omitempty"`
+	BatchLinger  time.Duration `json:"batch_linger,omitempty"`
+	PartitionKey string        `json:"partition_key,omitempty"`
+}
+
+func (o *publishOptions) options() []broker.PublishOption {
+	if o == nil {
+		return nil
+	}
+
+	var opts []broker.PublishOption
+	if len(o.Compression) > 0 {
+		opts = append(opts, broker.Compress(o.Compression))
+	}
+	if o.BatchSize > 0 {
+		opts = append(opts, broker.Batch(o.BatchSize, o.BatchLinger))
+	}
+	if len(o.PartitionKey) > 0 {
+		opts = append(opts, broker.PartitionKey(o.PartitionKey))
+	}
+	return opts
+}
+
+// messageQueue is a min heap ordered by delivery time
+type messageQueue []*message
+
+func (q messageQueue) Len() int           { return len(q) }
+func (q messageQueue) Less(i, j int) bool { return q[i].At.Before(q[j].At) }
+
+func (q messageQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *messageQueue) Push(x interface{}) {
+	m := x.(*message)
+	m.index = len(*q)
+	*q = append(*q, m)
+}
+
+func (q *messageQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	m := old[n-1]
+	old[n-1] = nil
+	m.index = -1
+	*q = old[:n-1]
+	return m
+}
+
+func (s *scheduleBroker) push(m *message) {
+	if _, ok := s.pending[m.ID]; ok {
+		return
+	}
+	heap.Push(&s.queue, m)
+	s.pending[m.ID] = m
+
+	// let the loop pick up an earlier deadline
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+func (s *scheduleBroker) save(m *message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return s.opts.Store.Write(&store.Record{
+		Key:   m.ID,
+		Value: b,
+	}, store.WriteTo(s.opts.Database, s.opts.Table))
+}
+
+// load queues messages persisted by a previous run
+func (s *scheduleBroker) load() error {
+	keys, err := s.opts.Store.List(store.ListFrom(s.opts.Database, s.opts.Table))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		recs, err := s.opts.Store.Read(key, store.ReadFrom(s.opts.Database, s.opts.Table))
+		if err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, rec := range recs {
+			m := new(message)
+			if err := json.Unmarshal(rec.Value, m); err != nil {
+				s.opts.Logger.Logf(logger.ErrorLevel, "Failed to load scheduled message %s: %v", rec.Key, err)
+				continue
+			}
+			s.Lock()
+			s.push(m)
+			s.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// due pops every message whose time has come
+func (s *scheduleBroker) due() []*message {
+	s.Lock()
+	defer s.Unlock()
+
+	var msgs []*message
+	now := time.Now()
+
+	for s.queue.Len() > 0 && !s.queue[0].At.After(now) {
+		m := heap.Pop(&s.queue).(*message)
+		delete(s.pending, m.ID)
+		s.delivering[m.ID] = true
+		msgs = append(msgs, m)
+	}
+
+	return msgs
+}
+
+func (s *scheduleBroker) deliver(m *message) {
+	if err := s.Broker.Publish(m.Topic, m.Message, m.Options.options()...); err != nil {
+		s.opts.Logger.Logf(logger.ErrorLevel, "Failed to deliver scheduled message %s: %v", m.ID, err)
+
+		// try again later
+		m.At = time.Now().Add(s.opts.RetryInterval)
+		s.Lock()
+		delete(s.delivering, m.ID)
+		s.push(m)
+		s.Unlock()
+		return
+	}
+
+	if err := s.opts.Store.Delete(m.ID, store.DeleteFrom(s.opts.Database, s.opts.Table)); err != nil {
+		s.opts.Logger.Logf(logger.ErrorLevel, "Failed to delete scheduled message %s: %v", m.ID, err)
+	}
+
+	s.Lock()
+	delete(s.delivering, m.ID)
+	s.Unlock()
+}
+
+func (s *scheduleBroker) run(exit chan bool) {
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		for _, m := range s.due() {
+			s.deliver(m)
+		}
+
+		// sleep until the next message is due
+		s.Lock()
+		wait := time.Hour
+		if s.queue.Len() > 0 {
+			wait = time.Until(s.queue[0].At)
+		}
+		s.Unlock()
+
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(wait)
+
+		select {
+		case <-t.C:
+		case <-s.wake:
+		case <-exit:
+			return
+		}
+	}
+}
+
+func (s *scheduleBroker) Connect() error {
+	if err := s.Broker.Connect(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	connected := s.exit != nil
+	s.Unlock()
+	if connected {
+		return nil
+	}
+
+	// only mark connected once loaded so a failed load can be retried
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	if s.exit != nil {
+		s.Unlock()
+		return nil
+	}
+	s.exit = make(chan bool)
+	exit := s.exit
+	s.Unlock()
+
+	go s.run(exit)
+
+	return nil
+}
+
+func (s *scheduleBroker) Disconnect() error {
+	s.Lock()
+	if s.exit != nil {
+		close(s.exit)
+		s.exit = nil
+	}
+	s.Unlock()
+
+	return s.Broker.Disconnect()
+}
+
+func (s *scheduleBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.NewPublishOptions(opts...)
+
+	at, ok := options.Context.Value(deliverAtKey{}).(time.Time)
+	if !ok || !at.After(time.Now()) {
+		return s.Broker.Publish(topic, msg, opts...)
+	}
+
+	_, err := s.Schedule(topic, msg, at, opts...)
+	return err
+}
+
+func (s *scheduleBroker) Schedule(topic string, msg *broker.Message, at time.Time, opts ...broker.PublishOption) (string, error) {
+	if msg == nil {
+		return "", errors.New("no message to schedule")
+	}
+
+	options := broker.NewPublishOptions(opts...)
+
+	// set the Micro-ID header to be able to cancel the message
+	id := msg.Header[headers.ID]
+	if len(id) == 0 {
+		id = uuid.New().String()
+	}
+
+	m := &message{
+		ID:    id,
+		Topic: topic,
+		Message: &broker.Message{
+			Header: make(map[string]string),
+			Body:   msg.Body,
+		},
+		At: at,
+		Options: &publishOptions{
+			Compression:  options.Compression,
+			BatchSize:    options.BatchSize,
+			BatchLinger:  options.BatchLinger,
+			PartitionKey: options.PartitionKey,
+		},
+	}
+
+	for k, v := range msg.Header {
+		m.Message.Header[k] = v
+	}
+	m.Message.Header[headers.ID] = id
+
+	if err := s.save(m); err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	s.push(m)
+	s.Unlock()
+
+	return id, nil
+}
+
+func (s *scheduleBroker) Cancel(id string) error {
+	s.Lock()
+	if s.delivering[id] {
+		s.Unlock()
+		return ErrTooLate
+	}
+	m, ok := s.pending[id]
+	if ok {
+		heap.Remove(&s.queue, m.index)
+		delete(s.pending, id)
+	}
+	s.Unlock()
+
+	// not loaded yet but it may still be persisted
+	if !ok {
+		if _, err := s.opts.Store.Read(id, store.ReadFrom(s.opts.Database, s.opts.Table)); err == store.ErrNotFound {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return s.opts.Store.Delete(id, store.DeleteFrom(s.opts.Database, s.opts.Table))
+}
+
+func NewBroker(b broker.Broker, opts ...Option) Broker {
+	return &scheduleBroker{
+		Broker:     b,
+		opts:       NewOptions(opts...),
+		pending:    make(map[string]*message),
+		delivering: make(map[string]bool),
+		wake:       make(chan bool, 1),
+	}
+}
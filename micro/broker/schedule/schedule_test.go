@@ -0,0 +1,206 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/broker"
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/transport/headers"
+)
+
+// recordBroker records what gets published to it
+type recordBroker struct {
+	broker.Broker
+
+	delivered chan string
+	keys      chan string
+}
+
+func newRecordBroker() *recordBroker {
+	return &recordBroker{delivered: make(chan string, 10), keys: make(chan string, 10)}
+}
+
+func (r *recordBroker) Connect() error    { return nil }
+func (r *recordBroker) Disconnect() error { return nil }
+
+func (r *recordBroker) Publish(topic string, m *broker.Message, opts ...broker.PublishOption) error {
+	r.keys <- broker.NewPublishOptions(opts...).PartitionKey
+	r.delivered <- string(m.Body)
+	return nil
+}
+
+// failStore fails to list until fail is cleared
+type failStore struct {
+	store.Store
+	fail bool
+}
+
+func (f *failStore) List(opts ...store.ListOption) ([]string, error) {
+	if f.fail {
+		return nil, errors.New("unavailable")
+	}
+	return f.Store.List(opts...)
+}
+
+func TestSchedule(t *testing.T) {
+	rb := newRecordBroker()
+	b := NewBroker(rb, WithStore(store.NewMemoryStore()))
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	if err := b.Publish("test", &broker.Message{Body: []byte("now")}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	later := &broker.Message{Body: []byte("later")}
+	if err := b.Publish("test", later, DeliverAfter(time.Millisecond*200)); err != nil {
+		t.Fatal(err)
+	}
+	if later.Header != nil {
+		t.Fatalf("the message published was changed: %v", later.Header)
+	}
+	if err := b.Publish("test", &broker.Message{Body: []byte("sooner")}, DeliverAt(start.Add(time.Millisecond*100))); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled := &broker.Message{
+		Header: map[string]string{headers.ID: "cancel-me"},
+		Body:   []byte("cancelled"),
+	}
+	if err := b.Publish("test", cancelled, DeliverAfter(time.Millisecond*150)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Cancel("cancel-me"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Cancel("cancel-me"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, expect := range []string{"now", "sooner", "later"} {
+		select {
+		case got := <-rb.delivered:
+			if got != expect {
+				t.Fatalf("expected %s, got %s", expect, got)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for %s", expect)
+		}
+	}
+
+	if time.Since(start) < time.Millisecond*200 {
+		t.Fatal("delayed message was delivered early")
+	}
+
+	select {
+	case got := <-rb.delivered:
+		t.Fatalf("unexpected delivery of %s", got)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestScheduleRestore(t *testing.T) {
+	s := &failStore{Store: store.NewMemoryStore(), fail: true}
+
+	// publish without connecting, as if the process stopped
+	b := NewBroker(newRecordBroker(), WithStore(s))
+	msg := &broker.Message{Body: []byte("persisted")}
+	if err := b.Publish("test", msg, DeliverAfter(time.Millisecond*50), broker.PartitionKey("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	rb := newRecordBroker()
+	b = NewBroker(rb, WithStore(s))
+	if err := b.Connect(); err == nil {
+		t.Fatal("expected connect to fail while the store is unavailable")
+	}
+
+	// connecting again loads the messages once the store is back
+	s.fail = false
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	select {
+	case got := <-rb.delivered:
+		if got != "persisted" {
+			t.Fatalf("unexpected delivery of %s", got)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("persisted message was not delivered")
+	}
+	if key := <-rb.keys; key != "order-1" {
+		t.Fatalf("expected the partition key to be kept, got %q", key)
+	}
+
+	keys, err := s.List(store.ListFrom("", "schedule"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("delivered message still stored: %v", keys)
+	}
+}
+
+// blockBroker holds every publish until release is closed
+type blockBroker struct {
+	broker.Broker
+
+	started chan bool
+	release chan bool
+}
+
+func (b *blockBroker) Connect() error    { return nil }
+func (b *blockBroker) Disconnect() error { return nil }
+
+func (b *blockBroker) Publish(topic string, m *broker.Message, opts ...broker.PublishOption) error {
+	b.started <- true
+	<-b.release
+	return nil
+}
+
+func TestScheduleCancel(t *testing.T) {
+	bb := &blockBroker{started: make(chan bool, 1), release: make(chan bool)}
+	b := NewBroker(bb, WithStore(store.NewMemoryStore()))
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	msg := &broker.Message{Body: []byte("later")}
+	id, err := b.Schedule("test", msg, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) == 0 {
+		t.Fatal("expected a generated id")
+	}
+	if err := b.Cancel(id); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err = b.Schedule("test", msg, time.Now().Add(time.Millisecond*10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-bb.started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for delivery")
+	}
+
+	// the message is already on its way so it can't be cancelled
+	if err := b.Cancel(id); err != ErrTooLate {
+		t.Fatalf("expected ErrTooLate, got %v", err)
+	}
+	close(bb.release)
+}
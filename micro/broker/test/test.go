@@ -0,0 +1,225 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/broker"
+)
+
+// NewBroker returns a broker for a single test, the test connects it
+type NewBroker func(t testing.TB) broker.Broker
+
+// Timeout is how long a test waits for a message to be delivered
+var Timeout = time.Second * 5
+
+// Run runs the tests every broker.Broker implementation has to pass
+func Run(t *testing.T, newBroker NewBroker) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b broker.Broker)
+	}{
+		{"PubSub", testPubSub},
+		{"Topics", testTopics},
+		{"Queue", testQueue},
+		{"Unsubscribe", testUnsubscribe},
+		{"Concurrency", testConcurrency},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBroker(t)
+			if err := b.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer b.Disconnect()
+			tc.fn(t, b)
+		})
+	}
+}
+
+// collect records the bodies delivered to a handler
+type collect struct {
+	sync.Mutex
+	bodies []string
+	ch     chan *broker.Message
+}
+
+func newCollect() *collect {
+	return &collect{ch: make(chan *broker.Message, 1000)}
+}
+
+func (c *collect) handler(e broker.Event) error {
+	c.Lock()
+	c.bodies = append(c.bodies, string(e.Message().Body))
+	c.Unlock()
+	c.ch <- e.Message()
+	return nil
+}
+
+func (c *collect) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.bodies)
+}
+
+// wait blocks until n messages have been delivered
+func (c *collect) wait(t *testing.T, n int) []*broker.Message {
+	t.Helper()
+
+	var msgs []*broker.Message
+	for len(msgs) < n {
+		select {
+		case m := <-c.ch:
+			msgs = append(msgs, m)
+		case <-time.After(Timeout):
+			t.Fatalf("expected %d messages, got %d", n, len(msgs))
+		}
+	}
+	return msgs
+}
+
+// quiet fails if anything else is delivered within d
+func (c *collect) quiet(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	select {
+	case m := <-c.ch:
+		t.Fatalf("unexpected message %s", m.Body)
+	case <-time.After(d):
+	}
+}
+
+func subscribe(t *testing.T, b broker.Broker, topic string, c *collect, opts ...broker.SubscribeOption) broker.Subscriber {
+	t.Helper()
+
+	sub, err := b.Subscribe(topic, c.handler, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Topic() != topic {
+		t.Fatalf("expected topic %s, got %s", topic, sub.Topic())
+	}
+	return sub
+}
+
+func publish(t *testing.T, b broker.Broker, topic, body string) {
+	t.Helper()
+
+	msg := &broker.Message{
+		Header: map[string]string{"Test-Header": body},
+		Body:   []byte(body),
+	}
+	if err := b.Publish(topic, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testPubSub(t *testing.T, b broker.Broker) {
+	c := newCollect()
+	sub := subscribe(t, b, "test.pubsub", c)
+	defer sub.Unsubscribe()
+
+	publish(t, b, "test.pubsub", "hello")
+
+	m := c.wait(t, 1)[0]
+	if string(m.Body) != "hello" || m.Header["Test-Header"] != "hello" {
+		t.Fatalf("unexpected message %v %s", m.Header, m.Body)
+	}
+}
+
+func testTopics(t *testing.T, b broker.Broker) {
+	foo, bar := newCollect(), newCollect()
+	defer subscribe(t, b, "test.foo", foo).Unsubscribe()
+	defer subscribe(t, b, "test.bar", bar).Unsubscribe()
+
+	publish(t, b, "test.foo", "foo")
+	publish(t, b, "test.nobody", "nobody")
+
+	if m := foo.wait(t, 1)[0]; string(m.Body) != "foo" {
+		t.Fatalf("unexpected message %s", m.Body)
+	}
+	bar.quiet(t, time.Millisecond*100)
+	foo.quiet(t, time.Millisecond*10)
+}
+
+func testQueue(t *testing.T, b broker.Broker) {
+	const n = 20
+
+	q1, q2, all := newCollect(), newCollect(), newCollect()
+	defer subscribe(t, b, "test.queue", q1, broker.Queue("workers")).Unsubscribe()
+	defer subscribe(t, b, "test.queue", q2, broker.Queue("workers")).Unsubscribe()
+	defer subscribe(t, b, "test.queue", all).Unsubscribe()
+
+	for i := 0; i < n; i++ {
+		publish(t, b, "test.queue", fmt.Sprint(i))
+	}
+
+	all.wait(t, n)
+
+	// the group gets every message once between its members
+	deadline := time.Now().Add(Timeout)
+	for q1.count()+q2.count() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	if got := q1.count() + q2.count(); got != n {
+		t.Fatalf("expected the queue group to get %d messages, got %d", n, got)
+	}
+}
+
+func testUnsubscribe(t *testing.T, b broker.Broker) {
+	c := newCollect()
+	sub := subscribe(t, b, "test.unsubscribe", c)
+
+	publish(t, b, "test.unsubscribe", "before")
+	c.wait(t, 1)
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, b, "test.unsubscribe", "after")
+	c.quiet(t, time.Millisecond*100)
+}
+
+func testConcurrency(t *testing.T, b broker.Broker) {
+	const publishers, messages = 8, 25
+
+	c := newCollect()
+	defer subscribe(t, b, "test.concurrency", c).Unsubscribe()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, publishers)
+
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				msg := &broker.Message{Body: []byte(fmt.Sprintf("%d-%d", i, j))}
+				if err := b.Publish("test.concurrency", msg); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range c.wait(t, publishers*messages) {
+		if seen[string(m.Body)] {
+			t.Fatalf("message %s delivered twice", m.Body)
+		}
+		seen[string(m.Body)] = true
+	}
+}
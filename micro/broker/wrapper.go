@@ -0,0 +1,44 @@
+package broker
+
+type PublishFunc func(topic string, m *Message, opts ...PublishOption) error
+
+type PublishWrapper func(PublishFunc) PublishFunc
+
+type SubscriberWrapper func(Handler) Handler
+
+type wrapper struct {
+	Broker
+}
+
+func (w *wrapper) Publish(topic string, m *Message, opts ...PublishOption) error {
+	pub := PublishFunc(w.Broker.Publish)
+	wrappers := w.Broker.Options().PublishWrappers
+
+	// wrap in reverse
+	for i := len(wrappers); i > 0; i-- {
+		pub = wrappers[i-1](pub)
+	}
+
+	return pub(topic, m, opts...)
+}
+
+func (w *wrapper) Subscribe(topic string, h Handler, opts ...SubscribeOption) (Subscriber, error) {
+	wrappers := w.Broker.Options().SubscriberWrappers
+
+	// wrap in reverse
+	for i := len(wrappers); i > 0; i-- {
+		h = wrappers[i-1](h)
+	}
+
+	return w.Broker.Subscribe(topic, h, opts...)
+}
+
+// Wrap applies the PublishWrappers and SubscriberWrappers set in the
+// options of b, so any implementation can be intercepted. The first
+// wrapper is the outermost one.
+func Wrap(b Broker) Broker {
+	if _, ok := b.(*wrapper); ok {
+		return b
+	}
+	return &wrapper{b}
+}
@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	var calls []string
+	done := make(chan bool)
+
+	pubWrapper := func(name string) PublishWrapper {
+		return func(fn PublishFunc) PublishFunc {
+			return func(topic string, m *Message, opts ...PublishOption) error {
+				calls = append(calls, name)
+				m.Header[name] = "true"
+				return fn(topic, m, opts...)
+			}
+		}
+	}
+
+	subWrapper := func(name string) SubscriberWrapper {
+		return func(h Handler) Handler {
+			return func(e Event) error {
+				calls = append(calls, name)
+				return h(e)
+			}
+		}
+	}
+
+	b := Wrap(newTestBroker(
+		WrapPublish(pubWrapper("pub1"), pubWrapper("pub2")),
+		WrapSubscriber(subWrapper("sub1")),
+	))
+
+	// wrappers added later still apply
+	if err := b.Init(WrapSubscriber(subWrapper("sub2"))); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := b.Subscribe("test", func(e Event) error {
+		if e.Message().Header["pub1"] != "true" || e.Message().Header["pub2"] != "true" {
+			t.Errorf("publish wrappers did not run: %v", e.Message().Header)
+		}
+		calls = append(calls, "handler")
+		close(done)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Publish("test", &Message{Header: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	<-done
+
+	expect := []string{"pub1", "pub2", "sub1", "sub2", "handler"}
+	if len(calls) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, calls)
+	}
+	for i := range expect {
+		if calls[i] != expect[i] {
+			t.Fatalf("expected %v, got %v", expect, calls)
+		}
+	}
+}
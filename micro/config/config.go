@@ -6,6 +6,7 @@ import (
 	"github.com/wxc/micro/config/loader"
 	"github.com/wxc/micro/config/reader"
 	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/config/source/file"
 )
 
 type Config interface {
@@ -16,6 +17,12 @@ type Config interface {
 	Load(source ...source.Source) error
 	Sync() error
 	Watch(path ...string) (Watcher, error)
+	// OnChange calls fn with the old and new value whenever the value
+	// at path changes
+	OnChange(fn ChangeFunc, path ...string) (Subscriber, error)
+	// WatchScan scans the value at path into v now and again whenever
+	// it changes. If v is a sync.Locker it is locked while scanning.
+	WatchScan(v interface{}, path ...string) (Subscriber, error)
 }
 
 type Watcher interface {
@@ -23,6 +30,12 @@ type Watcher interface {
 	Stop() error
 }
 
+type ChangeFunc func(old, new reader.Value)
+
+type Subscriber interface {
+	Unsubscribe() error
+}
+
 type Options struct {
 	Loader loader.Loader
 	Reader reader.Reader
@@ -53,6 +66,19 @@ func Map() map[string]interface{} {
 	return DefaultConfig.Map()
 }
 
+// Scan unmarshals the config into v, honouring these struct tags
+//
+//	default:"..."   value used when the key is missing
+//	required:"true" the key must be set
+//	min:"..."       minimum value, or length of strings, slices and maps
+//	max:"..."       maximum value, or length of strings, slices and maps
+//	oneof:"a b c"   the value must be one of the space separated list
+//	regex:"..."     strings must match the expression
+//
+// A null or empty string counts as missing. Structs in slices and string
+// keyed maps are checked too. time.Duration fields accept strings such as
+// "5s", as do their min and max tags. All missing, invalid and mistyped
+// paths are reported in one *ScanError.
 func Scan(v interface{}) error {
 	return DefaultConfig.Scan(v)
 }
@@ -73,6 +99,17 @@ func Watch(path ...string) (Watcher, error) {
 	return DefaultConfig.Watch(path...)
 }
 
+func OnChange(fn ChangeFunc, path ...string) (Subscriber, error) {
+	return DefaultConfig.OnChange(fn, path...)
+}
+
+func WatchScan(v interface{}, path ...string) (Subscriber, error) {
+	return DefaultConfig.WatchScan(v, path...)
+}
+
+// LoadFile is short hand for creating a file source and loading it
 func LoadFile(path string) error {
-	panic("in LoadFile")
+	return Load(file.NewSource(
+		file.WithPath(path),
+	))
 }
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/loader"
+	"github.com/wxc/micro/config/reader"
+	"github.com/wxc/micro/config/reader/json"
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/config/source/memory"
+)
+
+func newTestConfig(t *testing.T, data string) (Config, source.Source) {
+	t.Helper()
+
+	src := memory.NewSource(memory.WithJSON([]byte(data)))
+	c, err := NewConfig(WithSource(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, src
+}
+
+func update(t *testing.T, src source.Source, data string) {
+	t.Helper()
+
+	if err := src.Write(&source.ChangeSet{Data: []byte(data), Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// publish keeps writing data until done is closed, since the loader
+// starts watching its sources in the background
+func publish(t *testing.T, src source.Source, data string) chan bool {
+	done := make(chan bool)
+	go func() {
+		for {
+			update(t, src, data)
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond * 20):
+			}
+		}
+	}()
+	return done
+}
+
+func TestWatch(t *testing.T) {
+	c, src := newTestConfig(t, `{"flags": {"a": true}, "other": 1}`)
+
+	w, err := c.Watch("flags", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	done := make(chan reader.Value, 1)
+	go func() {
+		v, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- v
+	}()
+
+	// a change elsewhere must not wake the watcher
+	p := publish(t, src, `{"flags": {"a": true}, "other": 2}`)
+	select {
+	case v := <-done:
+		t.Fatalf("unexpected change %s", v.Bytes())
+	case <-time.After(time.Millisecond * 100):
+	}
+	close(p)
+
+	p = publish(t, src, `{"flags": {"a": false}, "other": 2}`)
+	defer close(p)
+	select {
+	case v := <-done:
+		if v.Bool(true) {
+			t.Fatalf("expected a to be false, got %s", v.Bytes())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	c, src := newTestConfig(t, `{"flags": {"a": 1}}`)
+
+	type change struct{ old, new int }
+	changes := make(chan change, 10)
+
+	s, err := c.OnChange(func(old, new reader.Value) {
+		changes <- change{old.Int(0), new.Int(0)}
+	}, "flags", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := publish(t, src, `{"flags": {"a": 2}}`)
+	select {
+	case ch := <-changes:
+		if ch.old != 1 || ch.new != 2 {
+			t.Fatalf("unexpected change %+v", ch)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+
+	close(p)
+
+	if err := s.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	update(t, src, `{"flags": {"a": 3}}`)
+	select {
+	case ch := <-changes:
+		t.Fatalf("change %+v after unsubscribe", ch)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+// chanWatcher is a loader watcher fed from a channel
+type chanWatcher struct {
+	next chan *loader.Snapshot
+	exit chan bool
+}
+
+func (w *chanWatcher) Next() (*loader.Snapshot, error) {
+	select {
+	case s := <-w.next:
+		return s, nil
+	case <-w.exit:
+		return nil, source.ErrWatcherStopped
+	}
+}
+
+func (w *chanWatcher) Stop() error {
+	close(w.exit)
+	return nil
+}
+
+// failReader fails to read change sets with the data bad
+type failReader struct {
+	reader.Reader
+}
+
+func (r failReader) Values(cs *source.ChangeSet) (reader.Values, error) {
+	if string(cs.Data) == "bad" {
+		return nil, errors.New("bad change set")
+	}
+	return r.Reader.Values(cs)
+}
+
+func TestSubscribeReadError(t *testing.T) {
+	rd := failReader{json.NewReader()}
+	// the loader watcher sends the value at the watched path
+	v, err := rd.Values(&source.ChangeSet{Data: []byte(`1`), Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lw := &chanWatcher{next: make(chan *loader.Snapshot), exit: make(chan bool)}
+	w := &watcher{lw: lw, rd: rd, value: v.Get(), path: []string{"a"}}
+
+	changes := make(chan int, 10)
+	s := subscribe(w, func(_, nv reader.Value) {
+		changes <- nv.Int(0)
+	})
+
+	// a change set the reader can't read doesn't end the subscription
+	lw.next <- &loader.Snapshot{ChangeSet: &source.ChangeSet{Data: []byte("bad"), Format: "json"}}
+	lw.next <- &loader.Snapshot{ChangeSet: &source.ChangeSet{Data: []byte(`2`), Format: "json"}}
+
+	select {
+	case n := <-changes:
+		if n != 2 {
+			t.Fatalf("expected 2, got %d", n)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+
+	if err := s.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type flags struct {
+	sync.RWMutex
+	Beta    bool `json:"beta"`
+	Percent int  `json:"percent"`
+}
+
+func TestWatchScan(t *testing.T) {
+	c, src := newTestConfig(t, `{"flags": {"beta": false, "percent": 10}}`)
+
+	f := new(flags)
+	s, err := c.WatchScan(f, "flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Unsubscribe()
+
+	f.RLock()
+	if f.Beta || f.Percent != 10 {
+		t.Fatalf("unexpected initial scan %+v", f)
+	}
+	f.RUnlock()
+
+	p := publish(t, src, `{"flags": {"beta": true, "percent": 50}}`)
+	defer close(p)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		f.RLock()
+		beta, percent := f.Beta, f.Percent
+		f.RUnlock()
+
+		if beta && percent == 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flags not rescanned: beta=%v percent=%d", beta, percent)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"sync"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/wxc/micro/config/reader"
 	"github.com/wxc/micro/config/reader/json"
 	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/logger"
 )
 
 type config struct {
@@ -19,6 +21,11 @@ type config struct {
 	sync.RWMutex
 }
 
+type subscriber struct {
+	w    *watcher
+	exit chan bool
+}
+
 type watcher struct {
 	lw    loader.Watcher
 	rd    reader.Reader
@@ -98,11 +105,17 @@ func (c *config) run() {
 				continue
 			}
 
+			// set values
+			vals, err := c.opts.Reader.Values(snap.ChangeSet)
+			if err != nil {
+				c.Unlock()
+				logger.Errorf("config: ignoring snapshot %s: %v", snap.Version, err)
+				continue
+			}
+
 			// save
 			c.snap = snap
-
-			// set values
-			c.vals, _ = c.opts.Reader.Values(snap.ChangeSet)
+			c.vals = vals
 
 			c.Unlock()
 		}
@@ -151,9 +164,7 @@ func (c *config) Map() map[string]interface{} {
 }
 
 func (c *config) Scan(v interface{}) error {
-	c.RLock()
-	defer c.RUnlock()
-	return c.vals.Scan(v)
+	return scanInto(c.Bytes(), v)
 }
 
 func (c *config) Sync() error {
@@ -257,8 +268,103 @@ func (c *config) String() string {
 	return "config"
 }
 
+func (c *config) OnChange(fn ChangeFunc, path ...string) (Subscriber, error) {
+	w, err := c.Watch(path...)
+	if err != nil {
+		return nil, err
+	}
+	return subscribe(w.(*watcher), fn), nil
+}
+
+func (c *config) WatchScan(v interface{}, path ...string) (Subscriber, error) {
+	w, err := c.Watch(path...)
+	if err != nil {
+		return nil, err
+	}
+
+	// scan what the watcher compares against so no change is missed
+	if err := scan(v, w.(*watcher).value); err != nil {
+		w.Stop()
+		return nil, err
+	}
+
+	return subscribe(w.(*watcher), func(_, nv reader.Value) {
+		if err := scan(v, nv); err != nil {
+			logger.Errorf("config: failed to scan %v: %v", path, err)
+		}
+	}), nil
+}
+
+func scan(v interface{}, val reader.Value) error {
+	if l, ok := v.(sync.Locker); ok {
+		l.Lock()
+		defer l.Unlock()
+	}
+	return scanInto(val.Bytes(), v)
+}
+
+func subscribe(w *watcher, fn ChangeFunc) Subscriber {
+	s := &subscriber{w: w, exit: make(chan bool)}
+
+	go func() {
+		for {
+			old := w.value
+
+			v, err := w.Next()
+			select {
+			case <-s.exit:
+				return
+			default:
+			}
+			if err == source.ErrWatcherStopped {
+				logger.Errorf("config: watcher for %v stopped", w.path)
+				return
+			}
+			if err != nil {
+				// a bad change set, the next one may be fine
+				logger.Errorf("config: watcher for %v: %v", w.path, err)
+				continue
+			}
+
+			fn(old, v)
+		}
+	}()
+
+	return s
+}
+
+func (s *subscriber) Unsubscribe() error {
+	select {
+	case <-s.exit:
+		return nil
+	default:
+		close(s.exit)
+	}
+	return s.w.Stop()
+}
+
+// Next blocks until the value at the watched path changes
 func (w *watcher) Next() (reader.Value, error) {
-	panic("in Next")
+	for {
+		s, err := w.lw.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := w.rd.Values(s.ChangeSet)
+		if err != nil {
+			return nil, err
+		}
+
+		// only process changes
+		nv := v.Get()
+		if bytes.Equal(w.value.Bytes(), nv.Bytes()) {
+			continue
+		}
+
+		w.value = nv
+		return w.value, nil
+	}
 }
 
 func (w *watcher) Stop() error {
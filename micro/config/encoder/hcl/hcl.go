@@ -0,0 +1,158 @@
+package hcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/wxc/micro/config/encoder"
+)
+
+type hclEncoder struct{}
+
+// Encode writes json, which is valid hcl
+func (h hclEncoder) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode reads a block into a map when v is a *map[string]interface{}
+// so `a { b = 1 }` reads like {"a": {"b": 1}}. Repeated blocks become a
+// list and list literals, `a = [{ b = 1 }]`, stay lists.
+func (h hclEncoder) Decode(d []byte, v interface{}) error {
+	m, ok := v.(*map[string]interface{})
+	if !ok {
+		return hcl.Unmarshal(d, v)
+	}
+
+	// hcl reads a list of objects in json as repeated blocks, so a list
+	// of one would come back as an object
+	if t := bytes.TrimSpace(d); len(t) > 0 && t[0] == '{' {
+		return decodeJSON(t, m)
+	}
+
+	f, err := hcl.ParseBytes(d)
+	if err != nil {
+		return err
+	}
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return fmt.Errorf("hcl: unexpected root %T", f.Node)
+	}
+
+	vals, err := object(list)
+	if err != nil {
+		return err
+	}
+	*m = vals
+	return nil
+}
+
+func (h hclEncoder) String() string {
+	return "hcl"
+}
+
+func object(list *ast.ObjectList) (map[string]interface{}, error) {
+	vals := make(map[string]interface{})
+	// keys repeated as blocks, which are collected in a list
+	repeated := make(map[string]bool)
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			continue
+		}
+
+		v, err := value(item.Val)
+		if err != nil {
+			return nil, err
+		}
+		// `a "b" { }` nests the block under each label
+		for i := len(item.Keys) - 1; i > 0; i-- {
+			v = map[string]interface{}{key(item.Keys[i]): v}
+		}
+
+		k := key(item.Keys[0])
+		cur, ok := vals[k]
+		_, block := item.Val.(*ast.ObjectType)
+		switch {
+		case !ok || !block:
+			vals[k] = v
+		case repeated[k]:
+			vals[k] = append(cur.([]interface{}), v)
+		default:
+			vals[k] = []interface{}{cur, v}
+			repeated[k] = true
+		}
+	}
+
+	return vals, nil
+}
+
+func value(n ast.Node) (interface{}, error) {
+	switch t := n.(type) {
+	case *ast.ObjectType:
+		return object(t.List)
+	case *ast.ListType:
+		l := make([]interface{}, len(t.List))
+		for i, e := range t.List {
+			v, err := value(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	}
+
+	var v interface{}
+	if err := hcl.DecodeObject(&v, n); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodeJSON(d []byte, m *map[string]interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(d))
+	dec.UseNumber()
+
+	var vals map[string]interface{}
+	if err := dec.Decode(&vals); err != nil {
+		return err
+	}
+	for k, v := range vals {
+		vals[k] = numbers(v)
+	}
+	*m = vals
+	return nil
+}
+
+// numbers reads json numbers as ints where they fit, as hcl does
+func numbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := strconv.Atoi(t.String()); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = numbers(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = numbers(val)
+		}
+	}
+	return v
+}
+
+func key(k *ast.ObjectKey) string {
+	return fmt.Sprint(k.Token.Value())
+}
+
+func NewEncoder() encoder.Encoder {
+	return hclEncoder{}
+}
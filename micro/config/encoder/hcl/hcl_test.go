@@ -0,0 +1,85 @@
+package hcl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHCL(t *testing.T) {
+	e := NewEncoder()
+
+	in := map[string]interface{}{
+		"name": "a = b",
+		"id":   "007",
+		"server": map[string]interface{}{
+			"port":    8080,
+			"enabled": true,
+			"hosts":   []interface{}{"a", "b"},
+		},
+		// a list of one object stays a list
+		"backends": []interface{}{
+			map[string]interface{}{"host": "a"},
+		},
+	}
+
+	b, err := e.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]interface{}
+	if err := e.Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %v got %v", in, out)
+	}
+
+	testData := []struct {
+		hcl    string
+		expect map[string]interface{}
+	}{
+		{
+			`db { host = "localhost" }`,
+			map[string]interface{}{
+				"db": map[string]interface{}{"host": "localhost"},
+			},
+		},
+		{
+			`db { host = "a" }
+db { host = "b" }`,
+			map[string]interface{}{
+				"db": []interface{}{
+					map[string]interface{}{"host": "a"},
+					map[string]interface{}{"host": "b"},
+				},
+			},
+		},
+		{
+			`db = [{ host = "a" }]`,
+			map[string]interface{}{
+				"db": []interface{}{
+					map[string]interface{}{"host": "a"},
+				},
+			},
+		},
+		{
+			`service "api" { port = 80 }`,
+			map[string]interface{}{
+				"service": map[string]interface{}{
+					"api": map[string]interface{}{"port": 80},
+				},
+			},
+		},
+	}
+
+	for _, d := range testData {
+		var out map[string]interface{}
+		if err := e.Decode([]byte(d.hcl), &out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(d.expect, out) {
+			t.Fatalf("%s: expected %v got %v", d.hcl, d.expect, out)
+		}
+	}
+}
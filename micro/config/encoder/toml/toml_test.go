@@ -0,0 +1,34 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTOML(t *testing.T) {
+	e := NewEncoder()
+
+	in := map[string]interface{}{
+		"name": "a = b",
+		"id":   "007",
+		"server": map[string]interface{}{
+			"port":    int64(8080),
+			"enabled": true,
+			"hosts":   []interface{}{"a", "b"},
+			"rate":    0.5,
+		},
+	}
+
+	b, err := e.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]interface{}
+	if err := e.Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %v got %v", in, out)
+	}
+}
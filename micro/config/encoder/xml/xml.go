@@ -0,0 +1,199 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wxc/micro/config/encoder"
+)
+
+var (
+	// DefaultRoot is the element maps are wrapped in when encoding
+	DefaultRoot = "config"
+	// TextKey holds the text of an element that also has attributes or
+	// children
+	TextKey = "#text"
+)
+
+type xmlEncoder struct{}
+
+func (x xmlEncoder) Encode(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return xml.Marshal(v)
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err := encode(b, DefaultRoot, m); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Decode reads the children of the root element into a map when v is a
+// *map[string]interface{}. Repeated elements become lists, attributes are
+// read as fields and text next to them under TextKey. Text is parsed as a
+// number or bool only when it reads back the same, so "007" stays a
+// string.
+func (x xmlEncoder) Decode(d []byte, v interface{}) error {
+	m, ok := v.(*map[string]interface{})
+	if !ok {
+		return xml.Unmarshal(d, v)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(d))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			*m = map[string]interface{}{}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		val, err := decode(dec, start)
+		if err != nil {
+			return err
+		}
+		if vals, ok := val.(map[string]interface{}); ok {
+			*m = vals
+		} else {
+			*m = map[string]interface{}{}
+		}
+		return nil
+	}
+}
+
+func (x xmlEncoder) String() string {
+	return "xml"
+}
+
+func decode(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	vals := make(map[string]interface{})
+	for _, a := range start.Attr {
+		vals[a.Name.Local] = scalar(a.Value)
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			val, err := decode(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			add(vals, t.Name.Local, val)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(vals) == 0 {
+				return scalar(s), nil
+			}
+			if len(s) > 0 {
+				vals[TextKey] = scalar(s)
+			}
+			return vals, nil
+		}
+	}
+}
+
+func add(vals map[string]interface{}, k string, v interface{}) {
+	cur, ok := vals[k]
+	if !ok {
+		vals[k] = v
+		return
+	}
+	if l, ok := cur.([]interface{}); ok {
+		vals[k] = append(l, v)
+		return
+	}
+	vals[k] = []interface{}{cur, v}
+}
+
+// number matches the numbers scalar parses, leading zeros, signs and
+// spellings like inf are left alone
+var number = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+func scalar(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if !number.MatchString(s) {
+		return s
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+func encode(b *bytes.Buffer, name string, v interface{}) error {
+	switch t := v.(type) {
+	case []interface{}:
+		for _, val := range t {
+			if err := encode(b, name, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Fprintf(b, "<%s>", name)
+
+	switch t := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if k == TextKey {
+				if err := xml.EscapeText(b, []byte(fmt.Sprint(t[k]))); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := encode(b, k, t[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := xml.EscapeText(b, []byte(fmt.Sprint(t))); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(b, "</%s>", name)
+	return nil
+}
+
+func NewEncoder() encoder.Encoder {
+	return xmlEncoder{}
+}
@@ -0,0 +1,69 @@
+package xml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestXML(t *testing.T) {
+	e := NewEncoder()
+
+	in := map[string]interface{}{
+		"name": "a & b",
+		"server": map[string]interface{}{
+			"port":    8080,
+			"enabled": true,
+			"hosts":   []interface{}{"a", "b"},
+		},
+	}
+
+	b, err := e.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `<config><name>a &amp; b</name><server><enabled>true</enabled><hosts>a</hosts><hosts>b</hosts><port>8080</port></server></config>`
+	if string(b) != expect {
+		t.Fatalf("Expected %s got %s", expect, b)
+	}
+
+	var out map[string]interface{}
+	if err := e.Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %v got %v", in, out)
+	}
+
+	if err := e.Decode([]byte(`<config><db host="localhost" port="5432"/></config>`), &out); err != nil {
+		t.Fatal(err)
+	}
+	expectOut := map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost", "port": 5432},
+	}
+	if !reflect.DeepEqual(expectOut, out) {
+		t.Fatalf("Expected %v got %v", expectOut, out)
+	}
+
+	// the text of an element with attributes is kept
+	if err := e.Decode([]byte(`<config><db port="5432">localhost</db><id>007</id><on>t</on></config>`), &out); err != nil {
+		t.Fatal(err)
+	}
+	expectOut = map[string]interface{}{
+		"db": map[string]interface{}{"port": 5432, TextKey: "localhost"},
+		"id": "007",
+		"on": "t",
+	}
+	if !reflect.DeepEqual(expectOut, out) {
+		t.Fatalf("Expected %v got %v", expectOut, out)
+	}
+
+	b, err = e.Encode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `<config><db>localhost<port>5432</port></db><id>007</id><on>t</on></config>`
+	if string(b) != expect {
+		t.Fatalf("Expected %s got %s", expect, b)
+	}
+}
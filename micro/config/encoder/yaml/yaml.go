@@ -0,0 +1,59 @@
+package yaml
+
+import (
+	"fmt"
+
+	"github.com/wxc/micro/config/encoder"
+	"gopkg.in/yaml.v3"
+)
+
+type yamlEncoder struct{}
+
+func (y yamlEncoder) Encode(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (y yamlEncoder) Decode(d []byte, v interface{}) error {
+	if err := yaml.Unmarshal(d, v); err != nil {
+		return err
+	}
+
+	// maps with non string keys come back as map[interface{}]interface{}
+	// which can't be merged or encoded as json
+	if m, ok := v.(*map[string]interface{}); ok {
+		for k, val := range *m {
+			(*m)[k] = normalize(val)
+		}
+	}
+	return nil
+}
+
+func (y yamlEncoder) String() string {
+	return "yaml"
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = normalize(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalize(val)
+		}
+		return t
+	}
+	return v
+}
+
+func NewEncoder() encoder.Encoder {
+	return yamlEncoder{}
+}
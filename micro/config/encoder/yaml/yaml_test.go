@@ -0,0 +1,46 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestYAML(t *testing.T) {
+	e := NewEncoder()
+
+	in := map[string]interface{}{
+		"name": "a: b",
+		"id":   "007",
+		"server": map[string]interface{}{
+			"port":    8080,
+			"enabled": true,
+			"hosts":   []interface{}{"a", "b"},
+			"rate":    0.5,
+		},
+	}
+
+	b, err := e.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]interface{}
+	if err := e.Decode(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %v got %v", in, out)
+	}
+
+	// non string keys are read as strings
+	out = nil
+	if err := e.Decode([]byte("codes:\n  1: one\n  2: two\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"codes": map[string]interface{}{"1": "one", "2": "two"},
+	}
+	if !reflect.DeepEqual(expect, out) {
+		t.Fatalf("Expected %v got %v", expect, out)
+	}
+}
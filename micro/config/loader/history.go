@@ -0,0 +1,103 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// DefaultHistory is the number of snapshots kept by default
+	DefaultHistory = 10
+
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+)
+
+// HistoryLoader is a loader that keeps the last snapshots
+type HistoryLoader interface {
+	Loader
+	// History returns the kept snapshots, oldest first
+	History() ([]*Snapshot, error)
+	// Diff returns the changes from snapshot v1 to v2
+	Diff(v1, v2 string) ([]Change, error)
+	// Rollback makes the snapshot the active config again, as a new
+	// version, until the next change of a source
+	Rollback(version string) error
+}
+
+type ChangeType int
+
+const (
+	Added ChangeType = iota
+	Removed
+	Changed
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// Change of a single key between two snapshots
+type Change struct {
+	Type ChangeType
+	Path []string
+	From interface{}
+	To   interface{}
+}
+
+// String leaves out the values, which may be secrets
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s", c.Type, strings.Join(c.Path, "."))
+}
+
+// Diff returns the key level changes from one set of values to another,
+// sorted by path. Maps are compared key by key, anything else as a whole.
+func Diff(from, to map[string]interface{}) []Change {
+	var changes []Change
+	diff(nil, from, to, &changes)
+	return changes
+}
+
+func diff(path []string, from, to map[string]interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := append(append([]string{}, path...), k)
+		f, inFrom := from[k]
+		t, inTo := to[k]
+
+		switch {
+		case !inFrom:
+			*changes = append(*changes, Change{Type: Added, Path: p, To: t})
+		case !inTo:
+			*changes = append(*changes, Change{Type: Removed, Path: p, From: f})
+		default:
+			fm, fok := f.(map[string]interface{})
+			tm, tok := t.(map[string]interface{})
+			if fok && tok {
+				diff(p, fm, tm, changes)
+			} else if !reflect.DeepEqual(f, t) {
+				*changes = append(*changes, Change{Type: Changed, Path: p, From: f, To: t})
+			}
+		}
+	}
+}
@@ -31,6 +31,8 @@ type Options struct {
 	Context             context.Context
 	Source              []source.Source
 	WithWatcherDisabled bool
+	// History is the number of snapshots to keep
+	History int
 }
 
 type Option func(o *Options)
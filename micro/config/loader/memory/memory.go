@@ -14,6 +14,7 @@ import (
 	"github.com/wxc/micro/config/reader"
 	"github.com/wxc/micro/config/reader/json"
 	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/logger"
 )
 
 type memory struct {
@@ -24,6 +25,7 @@ type memory struct {
 	opts     loader.Options
 	sets     []*source.ChangeSet
 	sources  []source.Source
+	history  []*loader.Snapshot
 	sync.RWMutex
 }
 
@@ -58,6 +60,7 @@ func (m *memory) watch(idx int, s source.Source) {
 			m.Lock()
 
 			// save
+			prev := m.sets[idx]
 			m.sets[idx] = cs
 
 			// merge sets
@@ -67,14 +70,26 @@ func (m *memory) watch(idx int, s source.Source) {
 				return err
 			}
 
-			// set values
-			m.vals, _ = m.opts.Reader.Values(set)
-			m.snap = &loader.Snapshot{
-				ChangeSet: set,
-				Version:   genVer(),
+			// set values, keeping the last good ones if the change
+			// can't be read, e.g. a reference fails to resolve
+			vals, err := m.opts.Reader.Values(set)
+			if err != nil {
+				m.sets[idx] = prev
+				m.Unlock()
+				logger.Errorf("config: ignoring change from %s: %v", cs.Source, err)
+				continue
 			}
+			var old map[string]interface{}
+			if m.vals != nil {
+				old = m.vals.Map()
+			}
+			snap := m.commit(set, vals)
 			m.Unlock()
 
+			if changes := loader.Diff(old, vals.Map()); len(changes) > 0 {
+				logger.Logf(logger.InfoLevel, "config: %s reloaded from %s: %v", snap.Version, cs.Source, changes)
+			}
+
 			// send watch updates
 			m.update()
 		}
@@ -137,13 +152,12 @@ func (m *memory) reload() error {
 	}
 
 	// set values
-	if vals, err := m.opts.Reader.Values(set); err != nil {
-		m.vals = vals
-	}
-	m.snap = &loader.Snapshot{
-		ChangeSet: set,
-		Version:   genVer(),
+	vals, err := m.opts.Reader.Values(set)
+	if err != nil {
+		m.Unlock()
+		return err
 	}
+	m.commit(set, vals)
 
 	m.Unlock()
 
@@ -236,11 +250,7 @@ func (m *memory) Sync() error {
 		m.Unlock()
 		return err
 	}
-	m.vals = vals
-	m.snap = &loader.Snapshot{
-		ChangeSet: set,
-		Version:   genVer(),
-	}
+	m.commit(set, vals)
 
 	m.Unlock()
 
@@ -382,7 +392,8 @@ func (w *watcher) Next() (*loader.Snapshot, error) {
 		w.value = v
 
 		cs := &source.ChangeSet{
-			Data:      v.Bytes(),
+			// the value is already preprocessed
+			Data:      reader.Escape(v.Bytes()),
 			Format:    w.reader.String(),
 			Source:    "memory",
 			Timestamp: time.Now(),
@@ -398,7 +409,7 @@ func (w *watcher) Next() (*loader.Snapshot, error) {
 	for {
 		select {
 		case <-w.exit:
-			return nil, errors.New("watcher stopped")
+			return nil, source.ErrWatcherStopped
 
 		// 接受更新检查版本和内容
 		case uv := <-w.updates:
@@ -423,15 +434,121 @@ func (w *watcher) Stop() error {
 	select {
 	case <-w.exit:
 	default:
+		// updates is left open, update may still be sending on it
 		close(w.exit)
-		close(w.updates)
 	}
 
 	return nil
 }
 
+// commit makes set the active snapshot and adds it to the history,
+// the lock must be held
+func (m *memory) commit(set *source.ChangeSet, vals reader.Values) *loader.Snapshot {
+	m.vals = vals
+	m.snap = &loader.Snapshot{
+		ChangeSet: set,
+		Version:   genVer(),
+	}
+
+	m.history = append(m.history, m.snap)
+	if n := len(m.history) - m.opts.History; n > 0 {
+		m.history = append([]*loader.Snapshot{}, m.history[n:]...)
+	}
+
+	return m.snap
+}
+
+func (m *memory) History() ([]*loader.Snapshot, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	snaps := make([]*loader.Snapshot, len(m.history))
+	for i, s := range m.history {
+		snaps[i] = loader.Copy(s)
+	}
+	return snaps, nil
+}
+
+// find returns the snapshot with the version, the lock must be held
+func (m *memory) find(version string) (*loader.Snapshot, error) {
+	for _, s := range m.history {
+		if s.Version == version {
+			return s, nil
+		}
+	}
+	return nil, loader.ErrSnapshotNotFound
+}
+
+func (m *memory) Diff(v1, v2 string) ([]loader.Change, error) {
+	m.RLock()
+	s1, err := m.find(v1)
+	if err != nil {
+		m.RUnlock()
+		return nil, err
+	}
+	s2, err := m.find(v2)
+	m.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	vals1, err := m.opts.Reader.Values(s1.ChangeSet)
+	if err != nil {
+		return nil, err
+	}
+	vals2, err := m.opts.Reader.Values(s2.ChangeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.Diff(vals1.Map(), vals2.Map()), nil
+}
+
+func (m *memory) Rollback(version string) error {
+	m.Lock()
+
+	s, err := m.find(version)
+	if err != nil {
+		m.Unlock()
+		return err
+	}
+
+	vals, err := m.opts.Reader.Values(s.ChangeSet)
+	if err != nil {
+		m.Unlock()
+		return err
+	}
+
+	var old map[string]interface{}
+	if m.vals != nil {
+		old = m.vals.Map()
+	}
+	snap := m.commit(s.ChangeSet, vals)
+	m.Unlock()
+
+	logger.Logf(logger.InfoLevel, "config: %s rolled back to %s: %v", snap.Version, version, loader.Diff(old, vals.Map()))
+
+	// update watchers
+	m.update()
+
+	return nil
+}
+
+var lastVer int64
+
+// genVer returns a timestamp, unique and increasing so versions
+// compare in order
 func genVer() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	for {
+		last := atomic.LoadInt64(&lastVer)
+		now := time.Now().UnixNano()
+		if now <= last {
+			now = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastVer, last, now) {
+			return fmt.Sprintf("%d", now)
+		}
+	}
 }
 
 func NewLoader(opts ...loader.Option) loader.Loader {
@@ -443,6 +560,10 @@ func NewLoader(opts ...loader.Option) loader.Loader {
 		o(&options)
 	}
 
+	if options.History <= 0 {
+		options.History = loader.DefaultHistory
+	}
+
 	m := &memory{
 		exit:     make(chan bool),
 		opts:     options,
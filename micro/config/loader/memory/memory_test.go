@@ -1,9 +1,12 @@
 package memory
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/wxc/micro/config/loader"
+	"github.com/wxc/micro/config/source"
 	sm "github.com/wxc/micro/config/source/memory"
 )
 
@@ -15,3 +18,66 @@ func TestMy(t *testing.T) {
 		t.Fatalf("get snapshot error: %s", err.Error())
 	}
 }
+
+func TestHistory(t *testing.T) {
+	src := sm.NewSource(sm.WithJSON([]byte(`{"a": 1, "b": {"c": "x"}}`)))
+	m := NewLoader(loader.WithSource(src), loader.WithHistory(2)).(loader.HistoryLoader)
+	defer m.Close()
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.Write(&source.ChangeSet{Data: []byte(`{"a": 2, "b": {"d": true}}`), Format: "json"})
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := m.Diff(first.Version, second.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []loader.Change{
+		{Type: loader.Changed, Path: []string{"a"}, From: json.Number("1"), To: json.Number("2")},
+		{Type: loader.Removed, Path: []string{"b", "c"}, From: "x"},
+		{Type: loader.Added, Path: []string{"b", "d"}, To: true},
+	}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Fatalf("expected %v got %v", expect, changes)
+	}
+
+	if err := m.Rollback(first.Version); err != nil {
+		t.Fatal(err)
+	}
+	current, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Version <= second.Version {
+		t.Fatalf("rollback did not create a new version: %s", current.Version)
+	}
+	if string(current.ChangeSet.Data) != string(first.ChangeSet.Data) {
+		t.Fatalf("expected %s got %s", first.ChangeSet.Data, current.ChangeSet.Data)
+	}
+
+	// only the last two are kept
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Version != second.Version || history[1].Version != current.Version {
+		t.Fatalf("unexpected history %v", history)
+	}
+	if err := m.Rollback(first.Version); err != loader.ErrSnapshotNotFound {
+		t.Fatalf("expected ErrSnapshotNotFound, got %v", err)
+	}
+}
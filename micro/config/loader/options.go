@@ -22,3 +22,10 @@ func WithWatcherDisabled() Option {
 		o.WithWatcherDisabled = true
 	}
 }
+
+// WithHistory keeps the last n snapshots.
+func WithHistory(n int) Option {
+	return func(o *Options) {
+		o.History = n
+	}
+}
@@ -1,7 +1,9 @@
 package json
 
 import (
+	"bytes"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/imdario/mergo"
@@ -14,6 +16,14 @@ import (
 type jsonReader struct {
 	opts reader.Options
 	json encoder.Encoder
+
+	// the last changeset preprocessed and the result, so resolvers run
+	// once per snapshot rather than on every read of it. Each merge, on
+	// a change or a sync, is a new snapshot and resolves them again.
+	sync.Mutex
+	at   time.Time
+	raw  []byte
+	data []byte
 }
 
 func (j *jsonReader) Merge(changes ...*source.ChangeSet) (*source.ChangeSet, error) {
@@ -66,7 +76,28 @@ func (j *jsonReader) Values(ch *source.ChangeSet) (reader.Values, error) {
 	if ch.Format != "json" {
 		return nil, errors.New("unsupported format")
 	}
-	return newValues(ch)
+
+	data, err := j.preprocess(ch)
+	if err != nil {
+		return nil, err
+	}
+	return newValues(ch, data)
+}
+
+func (j *jsonReader) preprocess(ch *source.ChangeSet) ([]byte, error) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.raw != nil && ch.Timestamp.Equal(j.at) && bytes.Equal(j.raw, ch.Data) {
+		return j.data, nil
+	}
+
+	data, err := reader.Preprocess(ch.Data, j.opts)
+	if err != nil {
+		return nil, err
+	}
+	j.at, j.raw, j.data = ch.Timestamp, append([]byte(nil), ch.Data...), data
+	return data, nil
 }
 
 func (j *jsonReader) String() string {
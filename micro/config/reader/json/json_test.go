@@ -1,8 +1,10 @@
 package json
 
 import (
+	"sync/atomic"
 	"testing"
 
+	"github.com/wxc/micro/config/reader"
 	"github.com/wxc/micro/config/source"
 )
 
@@ -46,3 +48,107 @@ func TestReader(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderFormats(t *testing.T) {
+	testData := []struct {
+		format string
+		data   string
+	}{
+		{"json", `{"server": {"port": 8080, "hosts": ["a", "b"]}}`},
+		{"yaml", "server:\n  port: 8080\n  hosts:\n    - a\n    - b\n"},
+		{"toml", "[server]\nport = 8080\nhosts = [\"a\", \"b\"]\n"},
+		{"hcl", "server {\n  port = 8080\n  hosts = [\"a\", \"b\"]\n}\n"},
+		{"xml", "<config><server><port>8080</port><hosts>a</hosts><hosts>b</hosts></server></config>"},
+	}
+
+	r := NewReader()
+
+	for _, test := range testData {
+		t.Run(test.format, func(t *testing.T) {
+			c, err := r.Merge(&source.ChangeSet{Data: []byte(test.data), Format: test.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := r.Values(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v := values.Get("server", "port").Int(0); v != 8080 {
+				t.Fatalf("Expected 8080 got %d", v)
+			}
+			if v := values.Get("server", "hosts").StringSlice(nil); len(v) != 2 || v[0] != "a" || v[1] != "b" {
+				t.Fatalf("Expected [a b] got %v", v)
+			}
+		})
+	}
+}
+
+func TestReaderYAMLKeys(t *testing.T) {
+	r := NewReader()
+
+	c, err := r.Merge(&source.ChangeSet{Data: []byte("codes:\n  404: missing\n  500: broken\n"), Format: "yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := r.Values(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := values.Get("codes", "404").String(""); v != "missing" {
+		t.Fatalf("Expected missing got %s", v)
+	}
+}
+
+func TestReaderPreprocessError(t *testing.T) {
+	r := NewReader()
+
+	c, err := r.Merge(&source.ChangeSet{Data: []byte(`{"password": "${READER_TEST_UNSET:?required}"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Values(c); err == nil {
+		t.Fatal("expected values to fail")
+	}
+}
+
+func TestReaderResolveOnce(t *testing.T) {
+	var calls int32
+	r := NewReader(reader.WithResolver("count", reader.ResolverFunc(func(key string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "v", nil
+	})))
+
+	c, err := r.Merge(&source.ChangeSet{Data: []byte(`{"a": "${count:a}"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		values, err := r.Values(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := values.Get("a").String(""); v != "v" {
+			t.Fatalf("Expected v got %s", v)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected the resolver to run once, ran %d times", n)
+	}
+	// merged again, e.g. on sync, rotated values are picked up
+	c, err = r.Merge(&source.ChangeSet{Data: []byte(`{"a": "${count:a}"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Values(c); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected the resolver to run again for a new snapshot, ran %d times", n)
+	}
+}
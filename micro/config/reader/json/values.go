@@ -21,9 +21,9 @@ type jsonValue struct {
 	*simple.Json
 }
 
-func newValues(ch *source.ChangeSet) (reader.Values, error) {
+// newValues reads data, the preprocessed data of ch
+func newValues(ch *source.ChangeSet, data []byte) (reader.Values, error) {
 	sj := simple.New()
-	data, _ := reader.ReplaceEnvVars(ch.Data)
 	if err := sj.UnmarshalJSON(data); err != nil {
 		sj.SetPath(nil, string(ch.Data))
 	}
@@ -32,7 +32,7 @@ func TestValues(t *testing.T) {
 	for idx, test := range testData {
 		values, err := newValues(&source.ChangeSet{
 			Data: test.csdata,
-		})
+		}, test.csdata)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -69,7 +69,7 @@ func TestStructArray(t *testing.T) {
 	for idx, test := range testData {
 		values, err := newValues(&source.ChangeSet{
 			Data: test.csdata,
-		})
+		}, test.csdata)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -2,11 +2,19 @@ package reader
 
 import (
 	"github.com/wxc/micro/config/encoder"
+	"github.com/wxc/micro/config/encoder/hcl"
 	"github.com/wxc/micro/config/encoder/json"
+	"github.com/wxc/micro/config/encoder/toml"
+	"github.com/wxc/micro/config/encoder/xml"
+	"github.com/wxc/micro/config/encoder/yaml"
 )
 
 type Options struct {
 	Encoding map[string]encoder.Encoder
+	// Preprocessors run in order over the data before it is read
+	Preprocessors []Preprocessor
+	// Resolvers for ${scheme:key} references, env is used for ${VAR}
+	Resolvers map[string]Resolver
 }
 
 type Option func(o *Options)
@@ -15,6 +23,14 @@ func NewOptions(opts ...Option) Options {
 	options := Options{
 		Encoding: map[string]encoder.Encoder{
 			"json": json.NewEncoder(),
+			"yaml": yaml.NewEncoder(),
+			"toml": toml.NewEncoder(),
+			"hcl":  hcl.NewEncoder(),
+			"xml":  xml.NewEncoder(),
+		},
+		Preprocessors: []Preprocessor{Expand},
+		Resolvers: map[string]Resolver{
+			"env": EnvResolver,
 		},
 	}
 	for _, o := range opts {
@@ -31,3 +47,21 @@ func WithEncoder(e encoder.Encoder) Option {
 		o.Encoding[e.String()] = e
 	}
 }
+
+// WithPreprocessor appends preprocessors to the chain.
+func WithPreprocessor(p ...Preprocessor) Option {
+	return func(o *Options) {
+		o.Preprocessors = append(o.Preprocessors, p...)
+	}
+}
+
+// WithResolver resolves ${scheme:key} references with r, for
+// example to read secrets from a vault.
+func WithResolver(scheme string, r Resolver) Option {
+	return func(o *Options) {
+		if o.Resolvers == nil {
+			o.Resolvers = make(map[string]Resolver)
+		}
+		o.Resolvers[scheme] = r
+	}
+}
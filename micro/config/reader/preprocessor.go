@@ -1,10 +1,274 @@
 package reader
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
+	"strings"
 )
 
+var (
+	// ErrNotFound is returned by a Resolver when the key is not set
+	ErrNotFound = errors.New("not found")
+
+	varName   = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	refScheme = regexp.MustCompile(`^([a-z][a-z0-9+.-]*):(.+)$`)
+)
+
+// Preprocessor rewrites the raw data of a changeset before it is read
+type Preprocessor func(raw []byte, opts Options) ([]byte, error)
+
+// Resolver looks up the value of a reference such as ${file:/path}
+type Resolver interface {
+	Resolve(key string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(key string) (string, error)
+
+func (r ResolverFunc) Resolve(key string) (string, error) {
+	return r(key)
+}
+
+// EnvResolver reads environment variables
+var EnvResolver = ResolverFunc(func(key string) (string, error) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, nil
+	}
+	return "", ErrNotFound
+})
+
+// FileResolver reads the contents of a file without the trailing newline.
+// It isn't one of the default resolvers, so config from a remote source
+// can't read local files, add it with WithResolver("file", FileResolver).
+var FileResolver = ResolverFunc(func(key string) (string, error) {
+	b, err := os.ReadFile(key)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+})
+
+// Preprocess runs the chain of preprocessors over raw
+func Preprocess(raw []byte, opts Options) ([]byte, error) {
+	var err error
+	for _, p := range opts.Preprocessors {
+		if raw, err = p(raw, opts); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// Expand substitutes references in the string values of raw json
+//
+//	${VAR}          the env var, or nothing if unset
+//	${VAR:-default} the default if the env var is unset or empty
+//	${VAR:?message} fails with the message if it is unset or empty
+//	${scheme:key}   the value of key from the resolver for scheme
+//	$${...}         a literal ${...}
+//
+// Keys, and anything outside a string, are left as is.
+func Expand(raw []byte, opts Options) ([]byte, error) {
+	if !bytes.Contains(raw, []byte("${")) {
+		return raw, nil
+	}
+
+	return values(raw, func(v string) (string, error) {
+		return expand(v, opts, true)
+	})
+}
+
+// values calls fn with the contents of every string in raw json which
+// isn't an object key, replacing it with the result
+func values(raw []byte, fn func(string) (string, error)) ([]byte, error) {
+	var b bytes.Buffer
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '"' {
+			b.WriteByte(raw[i])
+			continue
+		}
+
+		end := i + 1
+		for end < len(raw) && raw[end] != '"' {
+			if raw[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(raw) {
+			b.Write(raw[i:])
+			break
+		}
+
+		next := end + 1
+		for next < len(raw) && strings.IndexByte(" \t\r\n", raw[next]) >= 0 {
+			next++
+		}
+
+		v := string(raw[i+1 : end])
+		if next >= len(raw) || raw[next] != ':' {
+			var err error
+			if v, err = fn(v); err != nil {
+				return nil, err
+			}
+		}
+
+		b.WriteByte('"')
+		b.WriteString(v)
+		b.WriteByte('"')
+		i = end
+	}
+
+	return b.Bytes(), nil
+}
+
+func expand(s string, opts Options, quote bool) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		// escaped
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := closing(s, i+2)
+		if end < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+
+		v, ok, err := resolve(s[i+2:end], opts)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case !ok:
+			b.WriteString(s[i : end+1])
+		case quote:
+			b.WriteString(escape(v))
+		default:
+			b.WriteString(v)
+		}
+		i = end
+	}
+
+	return b.String(), nil
+}
+
+// Escape quotes the references in data that has already been expanded,
+// so reading it again yields the same values.
+func Escape(data []byte) []byte {
+	if !bytes.Contains(data, []byte("${")) {
+		return data
+	}
+
+	b, _ := values(data, func(v string) (string, error) {
+		return strings.ReplaceAll(v, "${", "$${"), nil
+	})
+	return b
+}
+
+// closing returns the index of the brace closing the reference at start
+func closing(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// resolve returns the value of the expression between the braces,
+// or false if it is not a reference
+func resolve(expr string, opts Options) (string, bool, error) {
+	lookup := func(scheme, key string) (string, bool, error) {
+		r, ok := opts.Resolvers[scheme]
+		if !ok {
+			return "", false, nil
+		}
+		v, err := r.Resolve(key)
+		if err == ErrNotFound {
+			return "", true, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("reader: resolving ${%s:%s}: %v", scheme, key, err)
+		}
+		return v, true, nil
+	}
+
+	if i := strings.Index(expr, ":-"); i > 0 && varName.MatchString(expr[:i]) {
+		v, _, err := lookup("env", expr[:i])
+		if err != nil || len(v) > 0 {
+			return v, true, err
+		}
+		v, err = expand(expr[i+2:], opts, false)
+		return v, true, err
+	}
+
+	if i := strings.Index(expr, ":?"); i > 0 && varName.MatchString(expr[:i]) {
+		v, _, err := lookup("env", expr[:i])
+		if err != nil || len(v) > 0 {
+			return v, true, err
+		}
+		msg := expr[i+2:]
+		if len(msg) == 0 {
+			msg = "not set"
+		}
+		return "", false, fmt.Errorf("reader: %s: %s", expr[:i], msg)
+	}
+
+	if varName.MatchString(expr) {
+		return lookup("env", expr)
+	}
+
+	if m := refScheme.FindStringSubmatch(expr); m != nil {
+		return lookup(m[1], m[2])
+	}
+
+	return "", false, nil
+}
+
+// escape makes v safe to place inside a json string
+func escape(v string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	// drop the quotes and newline added by the encoder
+	return string(b.Bytes()[1 : b.Len()-2])
+}
+
+// ReplaceEnvVars substitutes ${NAME} with the env var NAME.
+//
+// Deprecated: values are now preprocessed by Options.Preprocessors,
+// which default to Expand.
 func ReplaceEnvVars(raw []byte) ([]byte, error) {
 	re := regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
 	if re.Match(raw) {
@@ -2,6 +2,7 @@ package reader
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -71,3 +72,99 @@ func TestReplaceEnvVars(t *testing.T) {
 		}
 	}
 }
+
+func TestExpand(t *testing.T) {
+	os.Setenv("EXPAND_SET", "cat")
+	os.Setenv("EXPAND_EMPTY", "")
+	os.Setenv("EXPAND_QUOTE", `say "hi"`)
+
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewOptions(WithResolver("file", FileResolver), WithResolver("vault", ResolverFunc(func(key string) (string, error) {
+		if key == "db#password" {
+			return "hunter2", nil
+		}
+		return "", ErrNotFound
+	})))
+
+	testData := []struct {
+		expected string
+		data     string
+	}{
+		{`{"a": "cat"}`, `{"a": "${EXPAND_SET}"}`},
+		{`{"a": ""}`, `{"a": "${EXPAND_UNSET}"}`},
+		{`{"a": "cat"}`, `{"a": "${EXPAND_SET:-dog}"}`},
+		{`{"a": "dog"}`, `{"a": "${EXPAND_UNSET:-dog}"}`},
+		{`{"a": "dog"}`, `{"a": "${EXPAND_EMPTY:-dog}"}`},
+		{`{"a": "cat/x"}`, `{"a": "${EXPAND_UNSET:-${EXPAND_SET}/x}"}`},
+		{`{"a": "cat"}`, `{"a": "${EXPAND_SET:?must be set}"}`},
+		{`{"a": "say \"hi\""}`, `{"a": "${EXPAND_QUOTE}"}`},
+		{`{"a": "s3cr3t"}`, `{"a": "${file:` + secret + `}"}`},
+		{`{"a": "hunter2"}`, `{"a": "${vault:db#password}"}`},
+		{`{"a": "${EXPAND_SET}"}`, `{"a": "$${EXPAND_SET}"}`},
+		{`{"a": "${unknown:key}"}`, `{"a": "${unknown:key}"}`},
+		{`{"a": "${EXPAND_SET-}"}`, `{"a": "${EXPAND_SET-}"}`},
+		// keys are left alone
+		{`{"${EXPAND_SET}": "cat"}`, `{"${EXPAND_SET}": "${EXPAND_SET}"}`},
+		{`{"a": {"${EXPAND_SET}" : ["cat", "\"cat\""]}}`, `{"a": {"${EXPAND_SET}" : ["${EXPAND_SET}", "\"${EXPAND_SET}\""]}}`},
+	}
+
+	for _, test := range testData {
+		res, err := Preprocess([]byte(test.data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != test.expected {
+			t.Fatalf("Expected %s got %s", test.expected, res)
+		}
+
+		// expanded data read again is unchanged once escaped
+		again, err := Preprocess(Escape(res), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != test.expected {
+			t.Fatalf("Expected %s got %s when read again", test.expected, again)
+		}
+	}
+}
+
+func TestExpandFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// files are only read once the resolver is added
+	data := `{"a": "${file:` + secret + `}"}`
+	res, err := Preprocess([]byte(data), NewOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != data {
+		t.Fatalf("Expected %s got %s", data, res)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	opts := NewOptions(WithResolver("file", FileResolver))
+
+	_, err := Preprocess([]byte(`{"a": "${EXPAND_UNSET:?database password required}"}`), opts)
+	if err == nil || err.Error() != "reader: EXPAND_UNSET: database password required" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, err = Preprocess([]byte(`{"a": "${EXPAND_UNSET:?}"}`), opts)
+	if err == nil || err.Error() != "reader: EXPAND_UNSET: not set" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// a file that can't be read fails, one that doesn't exist is empty
+	_, err = Preprocess([]byte(`{"a": "${file:`+t.TempDir()+`}"}`), opts)
+	if err == nil {
+		t.Fatal("expected error reading a directory")
+	}
+}
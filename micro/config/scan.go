@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FieldError describes a missing or invalid value
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (f FieldError) Error() string {
+	return f.Path + " " + f.Message
+}
+
+// ScanError lists every field that failed to scan
+type ScanError struct {
+	Fields []FieldError
+}
+
+func (s *ScanError) Error() string {
+	msgs := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		msgs[i] = f.Error()
+	}
+	return "config: " + strings.Join(msgs, "; ")
+}
+
+// scanInto unmarshals data into v, applying the struct tags documented
+// on Scan. Every missing or invalid path is returned in a *ScanError.
+func scanInto(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("config: scan requires a non nil pointer, got %T", v)
+	}
+
+	t := rv.Elem().Type()
+	if t.Kind() != reflect.Struct {
+		return json.Unmarshal(data, v)
+	}
+
+	vals := map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var raw interface{}
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		// null or a non object leaves only the defaults
+		if m, ok := raw.(map[string]interface{}); ok {
+			vals = m
+		}
+	}
+
+	serr := new(ScanError)
+	prepare(t, vals, "", serr)
+	if len(serr.Fields) > 0 {
+		return serr
+	}
+
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// prepare walks the struct type alongside the decoded values, filling in
+// defaults, converting durations and validating what is set.
+func prepare(t reflect.Type, vals map[string]interface{}, path string, serr *ScanError) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+
+		name, skip := fieldName(f)
+		if skip {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// embedded structs are flattened by encoding/json
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Struct {
+				prepare(ft, vals, path, serr)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		key, val, ok := lookup(vals, name)
+		fp := join(path, name)
+		// null and "" count as missing
+		if val == nil || val == "" {
+			ok = false
+		}
+
+		if !ok {
+			if def, has := f.Tag.Lookup("default"); has {
+				d, err := parse(ft, def)
+				if err != nil {
+					serr.Fields = append(serr.Fields, FieldError{fp, "has invalid default: " + err.Error()})
+					continue
+				}
+				vals[key], val, ok = d, d, true
+			} else if f.Tag.Get("required") == "true" {
+				serr.Fields = append(serr.Fields, FieldError{fp, "is required"})
+				continue
+			}
+		}
+
+		if isStruct(ft) {
+			sub, isMap := val.(map[string]interface{})
+			if !ok {
+				sub, isMap = map[string]interface{}{}, true
+			}
+			if !isMap {
+				serr.Fields = append(serr.Fields, FieldError{fp, "is not a valid " + ft.String()})
+				continue
+			}
+			prepare(ft, sub, fp, serr)
+			if ok || len(sub) > 0 {
+				vals[key] = sub
+			}
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if handled, valid := elems(ft, val, fp, serr); handled {
+			if !valid {
+				continue
+			}
+			if msg := validate(f, ft, val); len(msg) > 0 {
+				serr.Fields = append(serr.Fields, FieldError{fp, msg})
+			}
+			continue
+		}
+
+		if ft == durationType {
+			if s, isStr := val.(string); isStr {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					serr.Fields = append(serr.Fields, FieldError{fp, "is not a valid duration"})
+					continue
+				}
+				val = json.Number(strconv.FormatInt(int64(d), 10))
+				vals[key] = val
+			}
+		}
+
+		if !decodes(f.Type, val) {
+			serr.Fields = append(serr.Fields, FieldError{fp, "is not a valid " + ft.String()})
+			continue
+		}
+
+		if msg := validate(f, ft, val); len(msg) > 0 {
+			serr.Fields = append(serr.Fields, FieldError{fp, msg})
+		}
+	}
+}
+
+// elems prepares the elements of slices and string keyed maps of structs,
+// handled is false for any other type and valid is false if val isn't a
+// list or object to match t
+func elems(t reflect.Type, val interface{}, path string, serr *ScanError) (handled, valid bool) {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map {
+		return false, false
+	}
+	if t.Kind() == reflect.Map && t.Key().Kind() != reflect.String {
+		return false, false
+	}
+	et := t.Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if !isStruct(et) {
+		return false, false
+	}
+
+	elem := func(v interface{}, p string) {
+		if v == nil {
+			return
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			serr.Fields = append(serr.Fields, FieldError{p, "is not a valid " + et.String()})
+			return
+		}
+		prepare(et, m, p, serr)
+	}
+
+	switch v := val.(type) {
+	case []interface{}:
+		if t.Kind() == reflect.Map {
+			break
+		}
+		for i, e := range v {
+			elem(e, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return true, true
+	case map[string]interface{}:
+		if t.Kind() != reflect.Map {
+			break
+		}
+		for k, e := range v {
+			elem(e, join(path, k))
+		}
+		return true, true
+	}
+
+	serr.Fields = append(serr.Fields, FieldError{path, "is not a valid " + t.String()})
+	return true, false
+}
+
+// decodes reports whether val can be unmarshalled into a t
+func decodes(t reflect.Type, val interface{}) bool {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, reflect.New(t).Interface()) == nil
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
+
+// lookup finds a key the way encoding/json does, preferring an exact match
+func lookup(vals map[string]interface{}, name string) (string, interface{}, bool) {
+	if v, ok := vals[name]; ok {
+		return name, v, true
+	}
+	for k, v := range vals {
+		if strings.EqualFold(k, name) {
+			return k, v, true
+		}
+	}
+	return name, nil, false
+}
+
+func join(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
+
+// parse converts a default tag into a value json can decode into t
+func parse(t reflect.Type, s string) (interface{}, error) {
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatInt(int64(d), 10)), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	case reflect.Slice:
+		var l []interface{}
+		for _, p := range strings.Split(s, ",") {
+			v, err := parse(t.Elem(), strings.TrimSpace(p))
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	}
+
+	// anything else is given as json
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// validate checks val against the min, max, oneof and regex tags
+func validate(f reflect.StructField, t reflect.Type, val interface{}) string {
+	// size returns the number compared against min and max
+	size := func() (float64, bool) {
+		switch v := val.(type) {
+		case json.Number:
+			n, err := v.Float64()
+			return n, err == nil
+		case string:
+			return float64(len(v)), true
+		case []interface{}:
+			return float64(len(v)), true
+		case map[string]interface{}:
+			return float64(len(v)), true
+		}
+		return 0, false
+	}
+
+	bound := func(s string) (float64, error) {
+		if t == durationType {
+			d, err := time.ParseDuration(s)
+			return float64(d), err
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+
+	if s, ok := f.Tag.Lookup("min"); ok {
+		min, err := bound(s)
+		if err != nil {
+			return "has invalid min tag " + s
+		}
+		if n, ok := size(); ok && n < min {
+			return "must be at least " + s
+		}
+	}
+
+	if s, ok := f.Tag.Lookup("max"); ok {
+		max, err := bound(s)
+		if err != nil {
+			return "has invalid max tag " + s
+		}
+		if n, ok := size(); ok && n > max {
+			return "must be at most " + s
+		}
+	}
+
+	if s, ok := f.Tag.Lookup("oneof"); ok {
+		str := fmt.Sprint(val)
+		var found bool
+		for _, o := range strings.Fields(s) {
+			if o == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "must be one of " + s
+		}
+	}
+
+	if s, ok := f.Tag.Lookup("regex"); ok {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return "has invalid regex tag " + s
+		}
+		if str, isStr := val.(string); !isStr || !re.MatchString(str) {
+			return "must match " + s
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type scanServer struct {
+	Host    string        `json:"host" default:"localhost"`
+	Port    int           `json:"port" default:"8080" min:"1" max:"65535"`
+	Timeout time.Duration `json:"timeout" default:"5s" min:"1s"`
+}
+
+type scanConfig struct {
+	Name   string      `json:"name" required:"true" regex:"^[a-z]+$"`
+	Level  string      `json:"level" default:"info" oneof:"debug info error"`
+	Tags   []string    `json:"tags" default:"a, b" max:"3"`
+	Server scanServer  `json:"server"`
+	Proxy  *scanServer `json:"proxy"`
+	Ignore string      `json:"-" default:"x"`
+	Opts   map[string]int
+}
+
+func TestScan(t *testing.T) {
+	var c scanConfig
+	err := scanInto([]byte(`{"name": "test", "server": {"port": 9090, "timeout": "1m"}, "opts": {"a": 1}}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := scanConfig{
+		Name:  "test",
+		Level: "info",
+		Tags:  []string{"a", "b"},
+		Server: scanServer{
+			Host:    "localhost",
+			Port:    9090,
+			Timeout: time.Minute,
+		},
+		Proxy: &scanServer{
+			Host:    "localhost",
+			Port:    8080,
+			Timeout: time.Second * 5,
+		},
+		Opts: map[string]int{"a": 1},
+	}
+	if !reflect.DeepEqual(c, expect) {
+		t.Fatalf("expected %+v got %+v", expect, c)
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	var c scanConfig
+	err := scanInto([]byte(`{
+		"level": "trace",
+		"tags": ["a", "b", "c", "d"],
+		"server": {"port": 0, "timeout": "soon"},
+		"proxy": {"timeout": "10ms"}
+	}`), &c)
+
+	var serr *ScanError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected a ScanError, got %v", err)
+	}
+
+	var paths []string
+	for _, f := range serr.Fields {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+
+	expect := []string{"level", "name", "proxy.timeout", "server.port", "server.timeout", "tags"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Fatalf("expected errors for %v got %v", expect, serr)
+	}
+}
+
+func TestScanConfig(t *testing.T) {
+	c, _ := newTestConfig(t, `{"server": {"port": 1234}}`)
+
+	var s scanServer
+	if err := c.Scan(&struct {
+		Server *scanServer `json:"server"`
+	}{&s}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Port != 1234 || s.Host != "localhost" || s.Timeout != time.Second*5 {
+		t.Fatalf("unexpected scan %+v", s)
+	}
+
+	var missing struct {
+		Name string `required:"true"`
+	}
+	if err := c.Scan(&missing); err == nil || err.Error() != "config: Name is required" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type scanBackend struct {
+	Host   string `json:"host" required:"true"`
+	Weight int    `json:"weight" default:"1" min:"1"`
+}
+
+type scanPool struct {
+	Name     string                  `json:"name" required:"true"`
+	Backends []scanBackend           `json:"backends" min:"1"`
+	Zones    map[string]*scanBackend `json:"zones"`
+	Port     int                     `json:"port"`
+	Debug    bool                    `json:"debug"`
+}
+
+func TestScanNested(t *testing.T) {
+	var p scanPool
+	err := scanInto([]byte(`{
+		"name": "web",
+		"backends": [{"host": "a"}, {"host": "b", "weight": 3}],
+		"zones": {"eu": {"host": "c"}}
+	}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := scanPool{
+		Name:     "web",
+		Backends: []scanBackend{{"a", 1}, {"b", 3}},
+		Zones:    map[string]*scanBackend{"eu": {"c", 1}},
+	}
+	if !reflect.DeepEqual(p, expect) {
+		t.Fatalf("expected %+v got %+v", expect, p)
+	}
+}
+
+func TestScanNestedErrors(t *testing.T) {
+	var p scanPool
+	err := scanInto([]byte(`{
+		"name": "",
+		"backends": [{"host": null}, {"host": "b", "weight": 0}, "c"],
+		"zones": {"eu": {"weight": 2}},
+		"port": "80",
+		"debug": 1
+	}`), &p)
+
+	var serr *ScanError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected a ScanError, got %v", err)
+	}
+
+	var paths []string
+	for _, f := range serr.Fields {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+
+	expect := []string{"backends[0].host", "backends[1].weight", "backends[2]", "debug", "name", "port", "zones.eu.host"}
+	if !reflect.DeepEqual(paths, expect) {
+		t.Fatalf("expected errors for %v got %v", expect, serr)
+	}
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Doc writes a markdown reference of every key of the struct v, with
+// the env variable and flag that set it.
+func Doc(w io.Writer, v interface{}, opts ...Option) error {
+	fields, err := Fields(v, opts...)
+	if err != nil {
+		return err
+	}
+
+	options := NewOptions(opts...)
+	if len(options.Title) > 0 {
+		if _, err := fmt.Fprintf(w, "# %s\n\n", options.Title); err != nil {
+			return err
+		}
+	}
+
+	rows := [][]string{{"Key", "Type", "Default", "Required", "Env", "Flag", "Description"}}
+	for _, f := range fields {
+		required := ""
+		if f.Required {
+			required = "yes"
+		}
+		flag := f.Flag
+		if len(flag) > 0 {
+			flag = "--" + flag
+		}
+		rows = append(rows, []string{
+			strings.Join(f.Path, "."), f.Type, code(f.Default), required, code(f.Env), code(flag), f.Description,
+		})
+	}
+
+	for i, row := range rows {
+		for j, c := range row {
+			row[j] = strings.ReplaceAll(c, "|", `\|`)
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+			return err
+		}
+		if i == 0 {
+			if _, err := fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(row))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func code(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return "`" + s + "`"
+}
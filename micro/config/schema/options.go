@@ -0,0 +1,35 @@
+package schema
+
+import "github.com/wxc/micro/config/source"
+
+type Options struct {
+	// Title of the generated schema and document
+	Title string
+	// Env are the options of the env source, used to name variables
+	Env []source.Option
+}
+
+type Option func(o *Options)
+
+func NewOptions(opts ...Option) Options {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// Title sets the title of the schema and document.
+func Title(t string) Option {
+	return func(o *Options) {
+		o.Title = t
+	}
+}
+
+// Env names variables as the env source created with opts reads them,
+// so prefixes match exactly.
+func Env(opts ...source.Option) Option {
+	return func(o *Options) {
+		o.Env = append(o.Env, opts...)
+	}
+}
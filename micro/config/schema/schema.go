@@ -0,0 +1,312 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wxc/micro/config/source/env"
+	"github.com/wxc/micro/config/source/flag"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Field describes a key of the config
+type Field struct {
+	Path        []string
+	Type        string
+	Default     string
+	Required    bool
+	Description string
+	// Env and Flag are empty when the source can't set the key
+	Env  string
+	Flag string
+}
+
+// Fields lists every key of the struct v, as read by config.Scan
+func Fields(v interface{}, opts ...Option) ([]Field, error) {
+	t, err := structType(v)
+	if err != nil {
+		return nil, err
+	}
+
+	options := NewOptions(opts...)
+
+	var fields []Field
+	walk(t, nil, func(path []string, f reflect.StructField, ft reflect.Type) {
+		field := Field{
+			Path:        path,
+			Type:        typeName(ft),
+			Default:     f.Tag.Get("default"),
+			Required:    f.Tag.Get("required") == "true",
+			Description: f.Tag.Get("description"),
+		}
+		field.Env, _ = env.Name(path, options.Env...)
+		field.Flag, _ = flag.Name(path...)
+		fields = append(fields, field)
+	})
+
+	return fields, nil
+}
+
+// Generate returns a JSON Schema for the struct v
+func Generate(v interface{}, opts ...Option) ([]byte, error) {
+	t, err := structType(v)
+	if err != nil {
+		return nil, err
+	}
+
+	options := NewOptions(opts...)
+
+	s := schemaOf(t)
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	if len(options.Title) > 0 {
+		s["title"] = options.Title
+	}
+
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func structType(v interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: expected a struct, got %T", v)
+	}
+	return t, nil
+}
+
+// walk calls fn for every leaf field of t the way encoding/json sees them
+func walk(t reflect.Type, path []string, fn func([]string, reflect.StructField, reflect.Type)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+
+		name, skip := fieldName(f)
+		if skip {
+			continue
+		}
+
+		ft := deref(f.Type)
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Struct {
+				walk(ft, path, fn)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		p := append(append([]string{}, path...), name)
+		if isStruct(ft) {
+			walk(ft, p, fn)
+			continue
+		}
+		fn(p, f, ft)
+	}
+}
+
+func schemaOf(t reflect.Type) map[string]interface{} {
+	t = deref(t)
+
+	switch {
+	case t == durationType:
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+
+	// interfaces accept anything
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() && !f.Anonymous {
+				continue
+			}
+
+			name, skip := fieldName(f)
+			if skip {
+				continue
+			}
+
+			ft := deref(f.Type)
+			if f.Anonymous && name == "" {
+				if ft.Kind() == reflect.Struct {
+					add(ft)
+				}
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			s := schemaOf(ft)
+			tags(s, f, ft)
+			props[name] = s
+
+			if f.Tag.Get("required") == "true" {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// tags adds the keywords for the default and validation tags of f
+func tags(s map[string]interface{}, f reflect.StructField, t reflect.Type) {
+	if d := f.Tag.Get("description"); len(d) > 0 {
+		s["description"] = d
+	}
+	if d, ok := f.Tag.Lookup("default"); ok {
+		s["default"] = value(t, d)
+	}
+
+	// min and max limit the length of strings and collections
+	min, max := "minimum", "maximum"
+	switch {
+	case t == durationType:
+		// durations may be strings so can't be bounded in the schema
+		min, max = "", ""
+	case t.Kind() == reflect.String:
+		min, max = "minLength", "maxLength"
+	case t.Kind() == reflect.Slice, t.Kind() == reflect.Array:
+		min, max = "minItems", "maxItems"
+	case t.Kind() == reflect.Map:
+		min, max = "minProperties", "maxProperties"
+	}
+	if v, ok := f.Tag.Lookup("min"); ok && len(min) > 0 {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			s[min] = n
+		}
+	}
+	if v, ok := f.Tag.Lookup("max"); ok && len(max) > 0 {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			s[max] = n
+		}
+	}
+
+	if v, ok := f.Tag.Lookup("oneof"); ok {
+		var enum []interface{}
+		for _, o := range strings.Fields(v) {
+			enum = append(enum, value(t, o))
+		}
+		s["enum"] = enum
+	}
+	if v, ok := f.Tag.Lookup("regex"); ok {
+		s["pattern"] = v
+	}
+}
+
+// value converts a tag to the type of the field
+func value(t reflect.Type, s string) interface{} {
+	if t == durationType {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case reflect.Slice:
+		var l []interface{}
+		for _, p := range strings.Split(s, ",") {
+			l = append(l, value(t.Elem(), strings.TrimSpace(p)))
+		}
+		return l
+	}
+
+	return s
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t == timeType:
+		return "time"
+	}
+
+	s := schemaOf(t)
+	if n, ok := s["type"].(string); ok {
+		if n == "array" {
+			return typeName(deref(t.Elem())) + "[]"
+		}
+		return n
+	}
+	return "any"
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType
+}
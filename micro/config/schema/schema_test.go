@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/source/env"
+)
+
+type testServer struct {
+	Host    string        `json:"host" default:"localhost" description:"address to bind"`
+	Port    int           `json:"port" default:"8080" min:"1" max:"65535"`
+	Timeout time.Duration `json:"timeout" default:"5s"`
+}
+
+type testConfig struct {
+	Name     string            `json:"name" required:"true" regex:"^[a-z]+$"`
+	Level    string            `json:"level" default:"info" oneof:"debug info error"`
+	Tags     []string          `json:"tags" max:"3"`
+	Server   testServer        `json:"server"`
+	MaxConns int               `json:"max_conns"`
+	Labels   map[string]string `json:"labels"`
+	Ignore   string            `json:"-"`
+}
+
+func TestFields(t *testing.T) {
+	fields, err := Fields(&testConfig{}, Env(env.WithStrippedPrefix("APP")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Field{
+		{Path: []string{"name"}, Type: "string", Required: true, Env: "APP_NAME", Flag: "name"},
+		{Path: []string{"level"}, Type: "string", Default: "info", Env: "APP_LEVEL", Flag: "level"},
+		{Path: []string{"tags"}, Type: "string[]", Env: "APP_TAGS", Flag: "tags"},
+		{Path: []string{"server", "host"}, Type: "string", Default: "localhost", Description: "address to bind", Env: "APP_SERVER_HOST", Flag: "server-host"},
+		{Path: []string{"server", "port"}, Type: "integer", Default: "8080", Env: "APP_SERVER_PORT", Flag: "server-port"},
+		{Path: []string{"server", "timeout"}, Type: "duration", Default: "5s", Env: "APP_SERVER_TIMEOUT", Flag: "server-timeout"},
+		{Path: []string{"max_conns"}, Type: "integer"},
+		{Path: []string{"labels"}, Type: "object", Env: "APP_LABELS", Flag: "labels"},
+	}
+	if !reflect.DeepEqual(fields, expect) {
+		t.Fatalf("expected %+v\ngot %+v", expect, fields)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	b, err := Generate(testConfig{}, Title("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s struct {
+		Title      string   `json:"title"`
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Type       interface{}            `json:"type"`
+			Default    interface{}            `json:"default"`
+			Enum       []interface{}          `json:"enum"`
+			Pattern    string                 `json:"pattern"`
+			MaxItems   float64                `json:"maxItems"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Title != "test" || !reflect.DeepEqual(s.Required, []string{"name"}) {
+		t.Fatalf("unexpected schema %s", b)
+	}
+	if p := s.Properties["name"]; p.Type != "string" || p.Pattern != "^[a-z]+$" {
+		t.Fatalf("unexpected name schema %+v", p)
+	}
+	if p := s.Properties["level"]; p.Default != "info" || len(p.Enum) != 3 {
+		t.Fatalf("unexpected level schema %+v", p)
+	}
+	if p := s.Properties["tags"]; p.Type != "array" || p.MaxItems != 3 {
+		t.Fatalf("unexpected tags schema %+v", p)
+	}
+
+	port, ok := s.Properties["server"].Properties["port"].(map[string]interface{})
+	if !ok || port["default"] != float64(8080) || port["minimum"] != float64(1) || port["maximum"] != float64(65535) {
+		t.Fatalf("unexpected port schema %v", port)
+	}
+	if _, ok := s.Properties["-"]; ok {
+		t.Fatal("ignored field in schema")
+	}
+
+	if _, err := Generate("nope"); err == nil {
+		t.Fatal("expected error for non struct")
+	}
+}
+
+func TestDoc(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	if err := Doc(b, testServer{}, Title("Server")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "# Server\n\n" +
+		"| Key | Type | Default | Required | Env | Flag | Description |\n" +
+		"| --- | --- | --- | --- | --- | --- | --- |\n" +
+		"| host | string | `localhost` |  | `HOST` | `--host` | address to bind |\n" +
+		"| port | integer | `8080` |  | `PORT` | `--port` |  |\n" +
+		"| timeout | duration | `5s` |  | `TIMEOUT` | `--timeout` |  |\n"
+	if b.String() != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, b.String())
+	}
+}
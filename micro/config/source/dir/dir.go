@@ -0,0 +1,220 @@
+package dir
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imdario/mergo"
+	"github.com/wxc/micro/config/encoder"
+	"github.com/wxc/micro/config/reader"
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/config/source/file"
+)
+
+var (
+	DefaultPath         = "conf.d"
+	DefaultPollInterval = time.Second
+)
+
+type dir struct {
+	path     string
+	glob     string
+	nested   bool
+	interval time.Duration
+	decoders map[string]encoder.Encoder
+	opts     source.Options
+}
+
+// entry is a supported file found in the tree
+type entry struct {
+	rel  string
+	path string
+}
+
+// walk returns the supported files in lexical order. Hidden files and
+// directories are skipped, which also leaves out editor swap files and
+// the timestamped directories of a kubernetes ConfigMap volume.
+func (d *dir) walk() ([]entry, error) {
+	var entries []entry
+
+	err := filepath.WalkDir(d.path, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == d.path {
+			return nil
+		}
+		if strings.HasPrefix(de.Name(), ".") {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if de.IsDir() {
+			return nil
+		}
+
+		// follow symlinked files but not directories
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.path, p)
+		if err != nil {
+			return err
+		}
+		if !d.match(rel) {
+			return nil
+		}
+		if _, ok := d.decoders[file.Format(rel, "")]; !ok {
+			return nil
+		}
+
+		entries = append(entries, entry{rel: rel, path: p})
+		return nil
+	})
+
+	return entries, err
+}
+
+func (d *dir) match(rel string) bool {
+	if len(d.glob) == 0 {
+		return true
+	}
+	if ok, _ := filepath.Match(d.glob, filepath.ToSlash(rel)); ok {
+		return true
+	}
+	ok, _ := filepath.Match(d.glob, filepath.Base(rel))
+	return ok
+}
+
+func (d *dir) Read() (*source.ChangeSet, error) {
+	entries, err := d.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	sum := md5.New()
+	var modified time.Time
+
+	for _, e := range entries {
+		cs, err := file.NewSource(file.WithPath(e.path)).Read()
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(sum, "%s\x00%s\x00", filepath.ToSlash(e.rel), cs.Checksum)
+		if cs.Timestamp.After(modified) {
+			modified = cs.Timestamp
+		}
+
+		codec, ok := d.decoders[cs.Format]
+		if !ok {
+			continue
+		}
+
+		var data map[string]interface{}
+		if len(cs.Data) > 0 {
+			if err := codec.Decode(cs.Data, &data); err != nil {
+				return nil, fmt.Errorf("%s: %v", e.rel, err)
+			}
+		}
+		if data == nil {
+			continue
+		}
+
+		if d.nested {
+			data = nest(e.rel, data)
+		}
+		if err := mergo.Map(&changes, data, mergo.WithOverride); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := d.opts.Encoder.Encode(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	return &source.ChangeSet{
+		Format:    d.opts.Encoder.String(),
+		Source:    d.String(),
+		Timestamp: modified,
+		Data:      b,
+		Checksum:  fmt.Sprintf("%x", sum.Sum(nil)),
+	}, nil
+}
+
+// nest places data under the path of the file, without its extension
+func nest(rel string, data map[string]interface{}) map[string]interface{} {
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+	keys := strings.Split(rel, "/")
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		data = map[string]interface{}{keys[i]: data}
+	}
+	return data
+}
+
+func (d *dir) Watch() (source.Watcher, error) {
+	if _, err := os.Stat(d.path); err != nil {
+		return nil, err
+	}
+	return newWatcher(d)
+}
+
+func (d *dir) Write(cs *source.ChangeSet) error {
+	return nil
+}
+
+func (d *dir) String() string {
+	return "dir"
+}
+
+func NewSource(opts ...source.Option) source.Source {
+	options := source.NewOptions(opts...)
+
+	d := &dir{
+		path:     DefaultPath,
+		interval: DefaultPollInterval,
+		decoders: reader.NewOptions().Encoding,
+		opts:     options,
+	}
+
+	if p, ok := options.Context.Value(dirPathKey{}).(string); ok {
+		d.path = filepath.Clean(p)
+	}
+	if g, ok := options.Context.Value(globKey{}).(string); ok {
+		d.glob = g
+	}
+	if n, ok := options.Context.Value(nestedKey{}).(bool); ok {
+		d.nested = n
+	}
+	if i, ok := options.Context.Value(pollIntervalKey{}).(time.Duration); ok && i > 0 {
+		d.interval = i
+	}
+	if decoders, ok := options.Context.Value(decoderKey{}).([]encoder.Encoder); ok {
+		for _, e := range decoders {
+			d.decoders[e.String()] = e
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,192 @@
+package dir
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+func write(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		// write via a hidden temp file so a poll never sees it half written
+		tmp := filepath.Join(filepath.Dir(p), ".tmp")
+		if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func read(t *testing.T, s source.Source) map[string]interface{} {
+	t.Helper()
+
+	cs, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(cs.Data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDirMerge(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"00-base.yaml":      "server:\n  port: 80\n  host: localhost\n",
+		"10-prod.json":      `{"server": {"port": 443}}`,
+		"20-extra/log.toml": "level = \"debug\"\n",
+		"README.md":         "not config",
+		".swp.json":         `{"server": {"port": 1}}`,
+	})
+
+	got := read(t, NewSource(WithPath(root)))
+	expect := map[string]interface{}{
+		"server": map[string]interface{}{"port": float64(443), "host": "localhost"},
+		"level":  "debug",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v got %v", expect, got)
+	}
+
+	got = read(t, NewSource(WithPath(root), WithGlob("*.yaml")))
+	expect = map[string]interface{}{
+		"server": map[string]interface{}{"port": float64(80), "host": "localhost"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v got %v", expect, got)
+	}
+}
+
+func TestDirNested(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"app.yml":        "name: test\n",
+		"db/primary.hcl": "host = \"db1\"\n",
+	})
+
+	got := read(t, NewSource(WithPath(root), Nested()))
+	expect := map[string]interface{}{
+		"app": map[string]interface{}{"name": "test"},
+		"db": map[string]interface{}{
+			"primary": map[string]interface{}{"host": "db1"},
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v got %v", expect, got)
+	}
+}
+
+func TestDirWatch(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{"a.json": `{"a": 1}`})
+
+	s := NewSource(WithPath(root), PollInterval(time.Millisecond*10))
+	before, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	done := make(chan *source.ChangeSet, 1)
+	go func() {
+		cs, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cs
+	}()
+
+	// give the watcher a poll with no changes first
+	time.Sleep(time.Millisecond * 50)
+	write(t, root, map[string]string{"b.json": `{"b": 2}`})
+
+	select {
+	case cs := <-done:
+		if cs.Checksum == before.Checksum {
+			t.Fatal("checksum did not change")
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(cs.Data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m["a"] != float64(1) || m["b"] != float64(2) {
+			t.Fatalf("unexpected data %s", cs.Data)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != source.ErrWatcherStopped {
+		t.Fatalf("expected ErrWatcherStopped, got %v", err)
+	}
+}
+
+func TestDirWatchSameStat(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, map[string]string{"a.json": `{"a": 1}`})
+
+	p := filepath.Join(root, "a.json")
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSource(WithPath(root), PollInterval(time.Millisecond*10))
+	w, err := s.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	done := make(chan *source.ChangeSet, 1)
+	go func() {
+		cs, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cs
+	}()
+
+	// same size and mod time, only the content differs
+	write(t, root, map[string]string{"a.json": `{"a": 2}`})
+	if err := os.Chtimes(p, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cs := <-done:
+		var m map[string]interface{}
+		if err := json.Unmarshal(cs.Data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m["a"] != float64(2) {
+			t.Fatalf("unexpected data %s", cs.Data)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+}
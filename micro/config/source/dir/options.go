@@ -0,0 +1,58 @@
+package dir
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/config/encoder"
+	"github.com/wxc/micro/config/source"
+)
+
+type dirPathKey struct{}
+type globKey struct{}
+type nestedKey struct{}
+type pollIntervalKey struct{}
+type decoderKey struct{}
+
+func setOption(k, v interface{}) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// WithPath sets the directory to load.
+func WithPath(p string) source.Option {
+	return setOption(dirPathKey{}, p)
+}
+
+// WithGlob only loads files whose path relative to the directory, or
+// whose base name, matches the pattern.
+func WithGlob(pattern string) source.Option {
+	return setOption(globKey{}, pattern)
+}
+
+// Nested puts each file under a path made from its relative path, so
+// db/primary.yaml is read as {"db": {"primary": ...}}. By default the
+// files are deep merged over each other in lexical order.
+func Nested() source.Option {
+	return setOption(nestedKey{}, true)
+}
+
+// PollInterval sets how often the watcher checks the tree for changes.
+func PollInterval(d time.Duration) source.Option {
+	return setOption(pollIntervalKey{}, d)
+}
+
+// WithDecoder supports an additional file format.
+func WithDecoder(e encoder.Encoder) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		decoders, _ := o.Context.Value(decoderKey{}).([]encoder.Encoder)
+		o.Context = context.WithValue(o.Context, decoderKey{}, append(decoders, e))
+	}
+}
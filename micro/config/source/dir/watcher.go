@@ -0,0 +1,75 @@
+package dir
+
+import (
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+// watcher polls the whole tree and emits one changeset for any
+// number of files added, removed or modified between polls.
+type watcher struct {
+	d    *dir
+	exit chan struct{}
+
+	sum string
+}
+
+func newWatcher(d *dir) (source.Watcher, error) {
+	w := &watcher{
+		d:    d,
+		exit: make(chan struct{}),
+	}
+
+	if _, err := w.poll(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// poll returns a changeset if the content of the tree changed. It reads
+// every file, sizes and mod times miss a rewrite within the resolution
+// of the file system clock.
+func (w *watcher) poll() (*source.ChangeSet, error) {
+	cs, err := w.d.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.Checksum == w.sum {
+		return nil, nil
+	}
+	w.sum = cs.Checksum
+
+	return cs, nil
+}
+
+func (w *watcher) Next() (*source.ChangeSet, error) {
+	t := time.NewTicker(w.d.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.exit:
+			return nil, source.ErrWatcherStopped
+		case <-t.C:
+		}
+
+		// a file may be mid write or rename, keep polling
+		cs, err := w.poll()
+		if err != nil || cs == nil {
+			continue
+		}
+		return cs, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	select {
+	case <-w.exit:
+	default:
+		close(w.exit)
+	}
+	return nil
+}
@@ -95,6 +95,37 @@ func matchPrefix(pre []string, s string) (string, bool) {
 	return "", false
 }
 
+// Name returns the environment variable that sets the value at path when
+// read by a source created with opts, or false if no variable can set it.
+func Name(path []string, opts ...source.Option) (string, bool) {
+	e := NewSource(opts...).(*env)
+
+	for _, p := range path {
+		// an underscore would split into another level
+		if len(p) == 0 || strings.Contains(p, "_") {
+			return "", false
+		}
+	}
+	name := strings.ToUpper(strings.Join(path, "_"))
+
+	if len(e.prefixes) == 0 && len(e.strippedPrefixes) == 0 {
+		return name, true
+	}
+
+	for _, p := range e.strippedPrefixes {
+		if strings.HasSuffix(p, "_") {
+			return p + name, true
+		}
+	}
+
+	// the prefix is kept so has to be part of the path
+	if _, ok := matchPrefix(e.prefixes, name); ok {
+		return name, true
+	}
+
+	return "", false
+}
+
 func (e *env) Watch() (source.Watcher, error) {
 	return newWatcher()
 }
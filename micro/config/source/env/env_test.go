@@ -106,3 +106,25 @@ func containsKey(m map[string]interface{}, s string) bool {
 	}
 	return false
 }
+
+func TestEnvvar_Name(t *testing.T) {
+	var nametests = []struct {
+		opts   []source.Option
+		path   []string
+		name   string
+		exists bool
+	}{
+		{nil, []string{"database", "host"}, "DATABASE_HOST", true},
+		{nil, []string{"max_conns"}, "", false},
+		{[]source.Option{WithStrippedPrefix("APP")}, []string{"database", "host"}, "APP_DATABASE_HOST", true},
+		{[]source.Option{WithPrefix("MICRO")}, []string{"micro", "registry"}, "MICRO_REGISTRY", true},
+		{[]source.Option{WithPrefix("MICRO")}, []string{"database", "host"}, "", false},
+	}
+
+	for _, nt := range nametests {
+		name, ok := Name(nt.path, nt.opts...)
+		if name != nt.name || ok != nt.exists {
+			t.Errorf("expected %v %q for %v, got %v %q", nt.exists, nt.name, nt.path, ok, name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+var (
+	DefaultPath         = "config.json"
+	DefaultPollInterval = time.Second
+)
+
+type file struct {
+	path     string
+	interval time.Duration
+	opts     source.Options
+}
+
+func (f *file) Read() (*source.ChangeSet, error) {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &source.ChangeSet{
+		Format:    Format(f.path, f.opts.Encoder.String()),
+		Source:    f.String(),
+		Timestamp: info.ModTime(),
+		Data:      b,
+	}
+	cs.Checksum = cs.Sum()
+
+	return cs, nil
+}
+
+func (f *file) Watch() (source.Watcher, error) {
+	if _, err := os.Stat(f.path); err != nil {
+		return nil, err
+	}
+	return newWatcher(f)
+}
+
+func (f *file) Write(cs *source.ChangeSet) error {
+	return nil
+}
+
+func (f *file) String() string {
+	return "file"
+}
+
+// Format infers the changeset format from the file extension,
+// returning def when there is none.
+func Format(p string, def string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(p), "."))
+	switch ext {
+	case "":
+		return def
+	case "yml":
+		return "yaml"
+	}
+	return ext
+}
+
+func NewSource(opts ...source.Option) source.Source {
+	options := source.NewOptions(opts...)
+
+	path := DefaultPath
+	if p, ok := options.Context.Value(filePathKey{}).(string); ok {
+		path = p
+	}
+
+	interval := DefaultPollInterval
+	if d, ok := options.Context.Value(pollIntervalKey{}).(time.Duration); ok && d > 0 {
+		interval = d
+	}
+
+	return &file{path: path, interval: interval, opts: options}
+}
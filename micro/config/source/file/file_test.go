@@ -0,0 +1,156 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+func next(t *testing.T, w source.Watcher) *source.ChangeSet {
+	t.Helper()
+
+	done := make(chan *source.ChangeSet, 1)
+	go func() {
+		cs, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cs
+	}()
+
+	select {
+	case cs := <-done:
+		return cs
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+	return nil
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte("foo: bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSource(WithPath(path))
+	cs, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Format != "yaml" {
+		t.Fatalf("expected yaml format, got %s", cs.Format)
+	}
+	if string(cs.Data) != "foo: bar" {
+		t.Fatalf("unexpected data %s", cs.Data)
+	}
+	if cs.Checksum != cs.Sum() {
+		t.Fatal("checksum not set")
+	}
+
+	if _, err := NewSource(WithPath(filepath.Join(dir, "missing.json"))).Read(); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist, got %v", err)
+	}
+	if f := Format(filepath.Join(dir, "config"), "json"); f != "json" {
+		t.Fatalf("expected encoder fallback, got %s", f)
+	}
+}
+
+func TestFileWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewSource(WithPath(path), PollInterval(time.Millisecond*10)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// written in place
+	if err := os.WriteFile(path, []byte(`{"a":2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cs := next(t, w); string(cs.Data) != `{"a":2}` {
+		t.Fatalf("unexpected data %s", cs.Data)
+	}
+
+	// saved the way most editors do, via a rename
+	tmp := filepath.Join(dir, ".config.json.swp")
+	if err := os.WriteFile(tmp, []byte(`{"a":3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if cs := next(t, w); string(cs.Data) != `{"a":3}` {
+		t.Fatalf("unexpected data %s", cs.Data)
+	}
+
+	// rewritten to the same size and mod time
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"a":4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if cs := next(t, w); string(cs.Data) != `{"a":4}` {
+		t.Fatalf("unexpected data %s", cs.Data)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != source.ErrWatcherStopped {
+		t.Fatalf("expected ErrWatcherStopped, got %v", err)
+	}
+}
+
+func TestFileWatchSymlink(t *testing.T) {
+	// lay the files out like a kubernetes ConfigMap volume
+	dir := t.TempDir()
+	for i, data := range []string{`{"v":1}`, `{"v":2}`} {
+		d := filepath.Join(dir, "..v"+string(rune('1'+i)))
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "config.json"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.Symlink(filepath.Join("..data", "config.json"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewSource(WithPath(path), PollInterval(time.Millisecond*10)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// swap ..data atomically
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if cs := next(t, w); string(cs.Data) != `{"v":2}` {
+		t.Fatalf("unexpected data %s", cs.Data)
+	}
+}
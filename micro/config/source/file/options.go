@@ -0,0 +1,31 @@
+package file
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+type filePathKey struct{}
+type pollIntervalKey struct{}
+
+// WithPath sets the path to the file.
+func WithPath(p string) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, filePathKey{}, p)
+	}
+}
+
+// PollInterval sets how often the watcher checks the file for changes.
+func PollInterval(d time.Duration) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pollIntervalKey{}, d)
+	}
+}
@@ -0,0 +1,78 @@
+package file
+
+import (
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+// watcher polls the file rather than relying on inotify so that editors
+// which save by renaming a temp file over the original, and symlink swaps
+// such as a kubernetes ConfigMap's ..data link, are picked up as well.
+type watcher struct {
+	f    *file
+	exit chan struct{}
+
+	sum string
+}
+
+func newWatcher(f *file) (source.Watcher, error) {
+	w := &watcher{
+		f:    f,
+		exit: make(chan struct{}),
+	}
+
+	// take the current state as the baseline
+	if _, err := w.poll(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// poll returns a changeset if the file content changed since the last
+// poll. It reads the file every time, sizes and mod times miss a rewrite
+// within the resolution of the file system clock.
+func (w *watcher) poll() (*source.ChangeSet, error) {
+	cs, err := w.f.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// touched or replaced with the same content
+	if cs.Checksum == w.sum {
+		return nil, nil
+	}
+	w.sum = cs.Checksum
+
+	return cs, nil
+}
+
+func (w *watcher) Next() (*source.ChangeSet, error) {
+	t := time.NewTicker(w.f.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.exit:
+			return nil, source.ErrWatcherStopped
+		case <-t.C:
+		}
+
+		// the file may briefly be missing mid-rename, keep polling
+		cs, err := w.poll()
+		if err != nil || cs == nil {
+			continue
+		}
+		return cs, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	select {
+	case <-w.exit:
+	default:
+		close(w.exit)
+	}
+	return nil
+}
@@ -64,6 +64,17 @@ func (fs *flagsrc) Read() (*source.ChangeSet, error) {
 	return cs, nil
 }
 
+// Name returns the flag that sets the value at path, or false if
+// no flag can set it. The cli source names its flags the same way.
+func Name(path ...string) (string, bool) {
+	for _, p := range path {
+		if len(p) == 0 || strings.IndexFunc(p, split) >= 0 {
+			return "", false
+		}
+	}
+	return strings.ToLower(strings.Join(path, "-")), true
+}
+
 func split(r rune) bool {
 	return r == '-' || r == '_'
 }
@@ -67,3 +67,12 @@ func TestFlagsrc_ReadAll(t *testing.T) {
 		t.Errorf("expected %v got %v", *dbuser, actualDB["user"])
 	}
 }
+
+func TestFlagsrc_Name(t *testing.T) {
+	if n, ok := Name("database", "user"); !ok || n != "database-user" {
+		t.Errorf("expected database-user, got %v %q", ok, n)
+	}
+	if _, ok := Name("max_conns"); ok {
+		t.Error("expected no flag for max_conns")
+	}
+}
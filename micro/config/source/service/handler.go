@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/wxc/micro/config/reader"
+	"github.com/wxc/micro/config/source"
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	// DefaultTable holds a record per namespace
+	DefaultTable = "config"
+	// DefaultRetries is how often a conflicting update is retried
+	DefaultRetries = 3
+)
+
+// WatchStream is the server side of a streaming watch
+type WatchStream interface {
+	Context() context.Context
+	Send(*WatchResponse) error
+}
+
+// Handler serves namespaced config out of a store.Store as the Config
+// endpoints. Each namespace is a json document in one record.
+type Handler struct {
+	// Name is the id of the errors returned
+	Name     string
+	Store    store.Store
+	Database string
+	Table    string
+	// PollInterval is used to watch a store which can't push changes
+	PollInterval time.Duration
+}
+
+func NewHandler(s store.Store) *Handler {
+	return &Handler{
+		Name:  DefaultService,
+		Store: s,
+		Table: DefaultTable,
+	}
+}
+
+// load returns the document of the namespace and its record, which is
+// nil if the namespace doesn't exist
+func (h *Handler) load(ns string) (map[string]interface{}, *store.Record, error) {
+	recs, err := h.Store.Read(ns, store.ReadFrom(h.Database, h.Table))
+	if err == store.ErrNotFound || (err == nil && len(recs) == 0) {
+		return map[string]interface{}{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, merr.InternalServerError(h.Name, err.Error())
+	}
+
+	doc, err := decode(recs[0].Value)
+	if err != nil {
+		return nil, nil, merr.InternalServerError(h.Name, err.Error())
+	}
+	return doc, recs[0], nil
+}
+
+func decode(b []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if len(b) == 0 {
+		return doc, nil
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc, nil
+}
+
+// update applies fn to the document of the namespace, retrying if it
+// was changed concurrently
+func (h *Handler) update(ns string, fn func(map[string]interface{}) error) error {
+	for i := 0; i < DefaultRetries; i++ {
+		doc, rec, err := h.load(ns)
+		if err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return merr.InternalServerError(h.Name, err.Error())
+		}
+
+		opts := []store.WriteOption{store.WriteTo(h.Database, h.Table)}
+		if rec == nil {
+			opts = append(opts, store.WriteIfNotExists())
+		} else {
+			opts = append(opts, store.WriteIfVersion(store.Version(rec)))
+		}
+
+		err = h.Store.Write(&store.Record{Key: ns, Value: b}, opts...)
+		if err == store.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return merr.InternalServerError(h.Name, err.Error())
+		}
+		return nil
+	}
+
+	return merr.Conflict(h.Name, "namespace %s was updated concurrently", ns)
+}
+
+func get(doc map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func changeSet(v interface{}) (*source.ChangeSet, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &source.ChangeSet{
+		Data:      b,
+		Format:    "json",
+		Source:    "service",
+		Timestamp: time.Now(),
+	}
+	cs.Checksum = cs.Sum()
+	return cs, nil
+}
+
+// Read returns the value at the path. A missing value is an empty object,
+// as it is for Watch, so config can be loaded before it is written.
+func (h *Handler) Read(ctx context.Context, req *ReadRequest, rsp *ReadResponse) error {
+	doc, _, err := h.load(req.Namespace)
+	if err != nil {
+		return err
+	}
+
+	v, ok := get(doc, req.Path)
+	if !ok {
+		v = map[string]interface{}{}
+	}
+
+	if rsp.ChangeSet, err = changeSet(v); err != nil {
+		return merr.InternalServerError(h.Name, err.Error())
+	}
+	return nil
+}
+
+func (h *Handler) Update(ctx context.Context, req *UpdateRequest, rsp *UpdateResponse) error {
+	if len(req.Namespace) == 0 {
+		return merr.BadRequest(h.Name, "namespace is required")
+	}
+	if req.ChangeSet == nil {
+		return merr.BadRequest(h.Name, "change set is required")
+	}
+
+	format := req.ChangeSet.Format
+	if len(format) == 0 {
+		format = "json"
+	}
+	enc, ok := reader.NewOptions().Encoding[format]
+	if !ok {
+		return merr.BadRequest(h.Name, "unsupported format %s", format)
+	}
+
+	var val interface{}
+	if err := enc.Decode(req.ChangeSet.Data, &val); err != nil {
+		return merr.BadRequest(h.Name, "invalid %s: %v", format, err)
+	}
+
+	if len(req.Path) == 0 {
+		doc, ok := val.(map[string]interface{})
+		if !ok {
+			return merr.BadRequest(h.Name, "namespace must be an object")
+		}
+		return h.update(req.Namespace, func(m map[string]interface{}) error {
+			for k := range m {
+				delete(m, k)
+			}
+			for k, v := range doc {
+				m[k] = v
+			}
+			return nil
+		})
+	}
+
+	return h.update(req.Namespace, func(m map[string]interface{}) error {
+		last := len(req.Path) - 1
+		for _, p := range req.Path[:last] {
+			next, ok := m[p].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[p] = next
+			}
+			m = next
+		}
+		m[req.Path[last]] = val
+		return nil
+	})
+}
+
+func (h *Handler) Delete(ctx context.Context, req *DeleteRequest, rsp *DeleteResponse) error {
+	if len(req.Path) == 0 {
+		err := h.Store.Delete(req.Namespace, store.DeleteFrom(h.Database, h.Table))
+		if err == store.ErrNotFound {
+			return merr.NotFound(h.Name, "%s not found", req.Namespace)
+		}
+		if err != nil {
+			return merr.InternalServerError(h.Name, err.Error())
+		}
+		return nil
+	}
+
+	last := len(req.Path) - 1
+	return h.update(req.Namespace, func(doc map[string]interface{}) error {
+		v, _ := get(doc, req.Path[:last])
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return merr.NotFound(h.Name, "%s %v not found", req.Namespace, req.Path)
+		}
+		if _, ok := m[req.Path[last]]; !ok {
+			return merr.NotFound(h.Name, "%s %v not found", req.Namespace, req.Path)
+		}
+		delete(m, req.Path[last])
+		return nil
+	})
+}
+
+// Watch sends the current value at the path, then the new one each time
+// it changes. A missing value is sent as an empty object.
+func (h *Handler) Watch(ctx context.Context, req *WatchRequest, stream WatchStream) error {
+	w, err := store.NewWatchStore(h.Store, h.PollInterval).Watch(
+		store.WatchFrom(h.Database, h.Table),
+		store.WatchKey(req.Namespace),
+	)
+	if err != nil {
+		return merr.InternalServerError(h.Name, err.Error())
+	}
+	defer w.Stop()
+
+	// events are coalesced so none are lost while sending
+	changed := make(chan bool, 1)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			// missed events are caught up on by reading again
+			if _, err := w.Next(); err != nil && err != store.ErrWatcherOverflow {
+				errs <- err
+				return
+			}
+			select {
+			case changed <- true:
+			default:
+			}
+		}
+	}()
+
+	var last []byte
+	for {
+		doc, _, err := h.load(req.Namespace)
+		if err != nil {
+			return err
+		}
+
+		v, ok := get(doc, req.Path)
+		if !ok {
+			v = map[string]interface{}{}
+		}
+		cs, err := changeSet(v)
+		if err != nil {
+			return merr.InternalServerError(h.Name, err.Error())
+		}
+		if string(cs.Data) != string(last) {
+			if err := stream.Send(&WatchResponse{ChangeSet: cs}); err != nil {
+				return err
+			}
+			last = cs.Data
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return merr.InternalServerError(h.Name, err.Error())
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import "github.com/wxc/micro/config/source"
+
+// ReadRequest reads the config of a namespace, or the value at Path in it
+type ReadRequest struct {
+	Namespace string   `json:"namespace"`
+	Path      []string `json:"path,omitempty"`
+}
+
+type ReadResponse struct {
+	ChangeSet *source.ChangeSet `json:"change_set"`
+}
+
+// UpdateRequest sets the value at Path, or the whole namespace, to the
+// data of the changeset
+type UpdateRequest struct {
+	Namespace string            `json:"namespace"`
+	Path      []string          `json:"path,omitempty"`
+	ChangeSet *source.ChangeSet `json:"change_set"`
+}
+
+type UpdateResponse struct{}
+
+// DeleteRequest removes the value at Path, or the whole namespace
+type DeleteRequest struct {
+	Namespace string   `json:"namespace"`
+	Path      []string `json:"path,omitempty"`
+}
+
+type DeleteResponse struct{}
+
+// WatchRequest streams the value at Path each time it changes
+type WatchRequest struct {
+	Namespace string   `json:"namespace"`
+	Path      []string `json:"path,omitempty"`
+}
+
+type WatchResponse struct {
+	ChangeSet *source.ChangeSet `json:"change_set"`
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+
+	"github.com/wxc/micro/config/source"
+)
+
+type serviceNameKey struct{}
+type namespaceKey struct{}
+type pathKey struct{}
+
+func setOption(k, v interface{}) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// ServiceName sets the name of the config service.
+func ServiceName(name string) source.Option {
+	return setOption(serviceNameKey{}, name)
+}
+
+// Namespace sets the namespace config is read from.
+func Namespace(ns string) source.Option {
+	return setOption(namespaceKey{}, ns)
+}
+
+// Path only reads the value at path in the namespace.
+func Path(path ...string) source.Option {
+	return setOption(pathKey{}, path)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+
+	"github.com/wxc/micro/client"
+	"github.com/wxc/micro/config/source"
+)
+
+var (
+	DefaultService   = "go.micro.config"
+	DefaultNamespace = "global"
+)
+
+type service struct {
+	opts      source.Options
+	name      string
+	namespace string
+	path      []string
+}
+
+func (s *service) client() client.Client {
+	if s.opts.Client != nil {
+		return s.opts.Client
+	}
+	return client.DefaultClient
+}
+
+func (s *service) context() context.Context {
+	if s.opts.Context != nil {
+		return s.opts.Context
+	}
+	return context.Background()
+}
+
+func (s *service) call(endpoint string, req, rsp interface{}) error {
+	c := s.client()
+	r := c.NewRequest(s.name, endpoint, req)
+	return c.Call(s.context(), r, rsp)
+}
+
+func (s *service) Read() (*source.ChangeSet, error) {
+	rsp := new(ReadResponse)
+	req := &ReadRequest{Namespace: s.namespace, Path: s.path}
+	if err := s.call("Config.Read", req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp.ChangeSet, nil
+}
+
+func (s *service) Write(cs *source.ChangeSet) error {
+	req := &UpdateRequest{Namespace: s.namespace, Path: s.path, ChangeSet: cs}
+	return s.call("Config.Update", req, new(UpdateResponse))
+}
+
+func (s *service) Watch() (source.Watcher, error) {
+	req := &WatchRequest{Namespace: s.namespace, Path: s.path}
+
+	c := s.client()
+	stream, err := c.Stream(s.context(), c.NewRequest(s.name, "Config.Watch", req, client.StreamingRequest()))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stream.Send(req); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return newWatcher(stream), nil
+}
+
+func (s *service) String() string {
+	return "service"
+}
+
+// NewSource returns a source reading a namespace of a remote config
+// service, served by a Handler, through Options.Client
+func NewSource(opts ...source.Option) source.Source {
+	options := source.NewOptions(opts...)
+
+	s := &service{
+		opts:      options,
+		name:      DefaultService,
+		namespace: DefaultNamespace,
+	}
+
+	if name, ok := options.Context.Value(serviceNameKey{}).(string); ok && len(name) > 0 {
+		s.name = name
+	}
+	if ns, ok := options.Context.Value(namespaceKey{}).(string); ok && len(ns) > 0 {
+		s.namespace = ns
+	}
+	if p, ok := options.Context.Value(pathKey{}).([]string); ok {
+		s.path = p
+	}
+
+	return s
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/wxc/micro/client"
+	"github.com/wxc/micro/codec"
+	"github.com/wxc/micro/config"
+	"github.com/wxc/micro/config/source"
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/file"
+)
+
+// testClient calls the handler directly, sending everything through json
+type testClient struct {
+	client.Client
+	h *Handler
+}
+
+type testRequest struct {
+	service, endpoint string
+	body              interface{}
+}
+
+func (r *testRequest) Service() string        { return r.service }
+func (r *testRequest) Method() string         { return r.endpoint }
+func (r *testRequest) Endpoint() string       { return r.endpoint }
+func (r *testRequest) ContentType() string    { return "application/json" }
+func (r *testRequest) Body() interface{}      { return r.body }
+func (r *testRequest) Codec() codec.Writer    { return nil }
+func (r *testRequest) Stream() bool           { return false }
+func (c *testClient) String() string          { return "test" }
+func (c *testClient) Options() client.Options { return client.Options{} }
+
+func roundTrip(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// wire turns handler errors into what a client would see
+func wire(err error) error {
+	if err == nil {
+		return nil
+	}
+	return merr.Parse(err.Error())
+}
+
+func (c *testClient) NewRequest(service, endpoint string, req interface{}, opts ...client.RequestOption) client.Request {
+	return &testRequest{service: service, endpoint: endpoint, body: req}
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	var err error
+
+	switch req.Endpoint() {
+	case "Config.Read":
+		in, out := new(ReadRequest), new(ReadResponse)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Read(ctx, in, out)
+		}
+		if err == nil {
+			err = roundTrip(out, rsp)
+		}
+	case "Config.Update":
+		in := new(UpdateRequest)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Update(ctx, in, new(UpdateResponse))
+		}
+	case "Config.Delete":
+		in := new(DeleteRequest)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Delete(ctx, in, new(DeleteResponse))
+		}
+	default:
+		return fmt.Errorf("unknown endpoint %s", req.Endpoint())
+	}
+
+	return wire(err)
+}
+
+func (c *testClient) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	if req.Endpoint() != "Config.Watch" {
+		return nil, fmt.Errorf("unknown endpoint %s", req.Endpoint())
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &testStream{ctx: ctx, cancel: cancel, h: c.h, rsp: make(chan []byte), done: make(chan error, 1)}, nil
+}
+
+type testStream struct {
+	client.Stream
+	ctx    context.Context
+	cancel context.CancelFunc
+	h      *Handler
+	rsp    chan []byte
+	done   chan error
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+// serverStream is the handler's end of a testStream
+type serverStream struct {
+	*testStream
+}
+
+func (s serverStream) Send(rsp *WatchResponse) error {
+	b, err := json.Marshal(rsp)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.rsp <- b:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *testStream) Send(v interface{}) error {
+	req := new(WatchRequest)
+	if err := roundTrip(v, req); err != nil {
+		return err
+	}
+	go func() {
+		s.done <- wire(s.h.Watch(s.ctx, req, serverStream{s}))
+	}()
+	return nil
+}
+
+func (s *testStream) Recv(v interface{}) error {
+	select {
+	case b := <-s.rsp:
+		return json.Unmarshal(b, v)
+	case err := <-s.done:
+		if err == nil {
+			return io.EOF
+		}
+		return err
+	}
+}
+
+func (s *testStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+func decodeChangeSet(t *testing.T, cs *source.ChangeSet) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(cs.Data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestServiceSource(t *testing.T) {
+	h := NewHandler(store.NewMemoryStore())
+	c := &testClient{h: h}
+
+	s := NewSource(source.WithClient(c), Namespace("app"))
+
+	// the namespace doesn't exist yet
+	cs, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decodeChangeSet(t, cs); !reflect.DeepEqual(v, map[string]interface{}{}) {
+		t.Fatalf("expected an empty object got %v", v)
+	}
+
+	if err := s.Write(&source.ChangeSet{Data: []byte(`{"db": {"host": "localhost"}}`), Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err = s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decodeChangeSet(t, cs); !reflect.DeepEqual(v, map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost"},
+	}) {
+		t.Fatalf("unexpected config %v", v)
+	}
+
+	// values at a path can be written in any format the reader knows
+	db := NewSource(source.WithClient(c), Namespace("app"), Path("db"))
+	err = c.Call(context.TODO(), c.NewRequest(DefaultService, "Config.Update", &UpdateRequest{
+		Namespace: "app",
+		Path:      []string{"db", "port"},
+		ChangeSet: &source.ChangeSet{Data: []byte("5432\n"), Format: "yaml"},
+	}), new(UpdateResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err = db.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decodeChangeSet(t, cs); !reflect.DeepEqual(v, map[string]interface{}{
+		"host": "localhost", "port": float64(5432),
+	}) {
+		t.Fatalf("unexpected config %v", v)
+	}
+
+	err = c.Call(context.TODO(), c.NewRequest(DefaultService, "Config.Update", &UpdateRequest{
+		Namespace: "app",
+		ChangeSet: &source.ChangeSet{Data: []byte("1"), Format: "json"},
+	}), new(UpdateResponse))
+	if e := merr.FromError(err); e.Code != 400 {
+		t.Fatalf("expected bad request got %v", err)
+	}
+
+	w, err := db.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// the current value is sent first
+	cs, err = w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decodeChangeSet(t, cs).(map[string]interface{}); v["host"] != "localhost" {
+		t.Fatalf("unexpected config %v", v)
+	}
+
+	err = c.Call(context.TODO(), c.NewRequest(DefaultService, "Config.Delete", &DeleteRequest{
+		Namespace: "app",
+		Path:      []string{"db", "port"},
+	}), new(DeleteResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err = w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decodeChangeSet(t, cs); !reflect.DeepEqual(v, map[string]interface{}{"host": "localhost"}) {
+		t.Fatalf("unexpected config %v", v)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != source.ErrWatcherStopped {
+		t.Fatalf("expected %v got %v", source.ErrWatcherStopped, err)
+	}
+}
+
+func TestServiceSourceMissing(t *testing.T) {
+	c := &testClient{h: NewHandler(store.NewMemoryStore())}
+
+	conf, err := config.NewConfig(
+		config.WithSource(NewSource(source.WithClient(c), Namespace("missing"))),
+		config.WithWatcherDisabled(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.Close()
+
+	if v := conf.Get("db", "host").String("localhost"); v != "localhost" {
+		t.Fatalf("expected the default got %s", v)
+	}
+}
+
+// TestHandlerConcurrentUpdate updates one namespace from many goroutines
+// through a store that is checked on disk, none of the writes may be lost
+func TestHandlerConcurrentUpdate(t *testing.T) {
+	st := file.NewStore(file.WithDir(t.TempDir()))
+	defer st.Close()
+	h := NewHandler(st)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				req := &UpdateRequest{
+					Namespace: "app",
+					Path:      []string{"keys", fmt.Sprintf("w%d-%d", i, j)},
+					ChangeSet: &source.ChangeSet{Data: []byte("true"), Format: "json"},
+				}
+				for {
+					err := h.Update(context.Background(), req, new(UpdateResponse))
+					// out of retries, a client would try again
+					if e := merr.FromError(err); err != nil && e.Code == 409 {
+						continue
+					}
+					if err != nil {
+						t.Error(err)
+					}
+					break
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	rsp := new(ReadResponse)
+	if err := h.Read(context.Background(), &ReadRequest{Namespace: "app", Path: []string{"keys"}}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	keys, ok := decodeChangeSet(t, rsp.ChangeSet).(map[string]interface{})
+	if !ok || len(keys) != 40 {
+		t.Fatalf("expected 40 keys, got %d: %s", len(keys), rsp.ChangeSet.Data)
+	}
+}
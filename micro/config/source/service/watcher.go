@@ -0,0 +1,44 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/wxc/micro/client"
+	"github.com/wxc/micro/config/source"
+)
+
+type watcher struct {
+	stream client.Stream
+
+	once sync.Once
+	exit chan bool
+}
+
+func newWatcher(stream client.Stream) *watcher {
+	return &watcher{
+		stream: stream,
+		exit:   make(chan bool),
+	}
+}
+
+func (w *watcher) Next() (*source.ChangeSet, error) {
+	rsp := new(WatchResponse)
+	if err := w.stream.Recv(rsp); err != nil {
+		select {
+		case <-w.exit:
+			return nil, source.ErrWatcherStopped
+		default:
+		}
+		return nil, err
+	}
+	return rsp.ChangeSet, nil
+}
+
+func (w *watcher) Stop() error {
+	var err error
+	w.once.Do(func() {
+		close(w.exit)
+		err = w.stream.Close()
+	})
+	return err
+}
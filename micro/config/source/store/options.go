@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/store"
+)
+
+type storeKey struct{}
+type databaseKey struct{}
+type tableKey struct{}
+type prefixKey struct{}
+type pollIntervalKey struct{}
+
+func setOption(k, v interface{}) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// WithStore sets the store config is read from.
+func WithStore(s store.Store) source.Option {
+	return setOption(storeKey{}, s)
+}
+
+// Database sets the database of the table.
+func Database(db string) source.Option {
+	return setOption(databaseKey{}, db)
+}
+
+// Table sets the table config is read from.
+func Table(t string) source.Option {
+	return setOption(tableKey{}, t)
+}
+
+// WithPrefix only reads keys with the prefix, which is stripped from
+// their path.
+func WithPrefix(p string) source.Option {
+	return setOption(prefixKey{}, p)
+}
+
+// PollInterval sets how often a store that can't watch is polled.
+func PollInterval(d time.Duration) source.Option {
+	return setOption(pollIntervalKey{}, d)
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/imdario/mergo"
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	DefaultTable = "config"
+)
+
+type storeSource struct {
+	store    store.Store
+	database string
+	table    string
+	prefix   string
+	interval time.Duration
+	opts     source.Options
+}
+
+// Read nests each value under its key split on "/", so the key
+// database/host sets {"database": {"host": ...}}. Values holding json
+// are decoded, anything else is read as a string.
+func (s *storeSource) Read() (*source.ChangeSet, error) {
+	recs, err := s.store.Read(s.prefix, store.ReadPrefix(), store.ReadFrom(s.database, s.table))
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, r := range recs {
+		var val interface{}
+		if err := json.Unmarshal(r.Value, &val); err != nil {
+			val = string(r.Value)
+		}
+
+		var path []string
+		if p := strings.Trim(strings.TrimPrefix(r.Key, s.prefix), "/"); len(p) > 0 {
+			path = strings.Split(p, "/")
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			val = map[string]interface{}{path[i]: val}
+		}
+
+		// a key of just the prefix holds a whole document
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := mergo.Map(&changes, m, mergo.WithOverride); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := s.opts.Encoder.Encode(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &source.ChangeSet{
+		Format:    s.opts.Encoder.String(),
+		Data:      b,
+		Timestamp: time.Now(),
+		Source:    s.String(),
+	}
+	cs.Checksum = cs.Sum()
+
+	return cs, nil
+}
+
+func (s *storeSource) Watch() (source.Watcher, error) {
+	return newWatcher(s)
+}
+
+func (s *storeSource) Write(cs *source.ChangeSet) error {
+	return nil
+}
+
+func (s *storeSource) String() string {
+	return "store"
+}
+
+// NewSource returns a source reading the keys of a store table,
+// store.DefaultStore unless WithStore is given.
+func NewSource(opts ...source.Option) source.Source {
+	options := source.NewOptions(opts...)
+
+	s := &storeSource{
+		store: store.DefaultStore,
+		table: DefaultTable,
+		opts:  options,
+	}
+
+	if v, ok := options.Context.Value(storeKey{}).(store.Store); ok {
+		s.store = v
+	}
+	if v, ok := options.Context.Value(databaseKey{}).(string); ok {
+		s.database = v
+	}
+	if v, ok := options.Context.Value(tableKey{}).(string); ok {
+		s.table = v
+	}
+	if v, ok := options.Context.Value(prefixKey{}).(string); ok {
+		s.prefix = v
+	}
+	if v, ok := options.Context.Value(pollIntervalKey{}).(time.Duration); ok {
+		s.interval = v
+	}
+
+	return s
+}
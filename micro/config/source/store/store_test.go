@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/store"
+)
+
+func TestStoreSource(t *testing.T) {
+	st := store.NewMemoryStore()
+	write := func(k, v string) {
+		if err := st.Write(&store.Record{Key: k, Value: []byte(v)}, store.WriteTo("", DefaultTable)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("app/database/host", "localhost")
+	write("app/database/port", "5432")
+	write("app/features", `{"beta": true}`)
+	write("other/key", "ignored")
+
+	s := NewSource(WithStore(st), WithPrefix("app/"), PollInterval(10*time.Millisecond))
+
+	read := func(cs *source.ChangeSet) map[string]interface{} {
+		var v map[string]interface{}
+		if err := json.Unmarshal(cs.Data, &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cs, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"database": map[string]interface{}{"host": "localhost", "port": float64(5432)},
+		"features": map[string]interface{}{"beta": true},
+	}
+	if v := read(cs); !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expected %v got %v", expected, v)
+	}
+
+	w, err := s.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	write("app/database/host", "db.internal")
+
+	next, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Checksum == cs.Checksum {
+		t.Fatal("expected the checksum to change")
+	}
+	if host := read(next)["database"].(map[string]interface{})["host"]; host != "db.internal" {
+		t.Fatalf("expected db.internal got %v", host)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != source.ErrWatcherStopped {
+		t.Fatalf("expected %v got %v", source.ErrWatcherStopped, err)
+	}
+}
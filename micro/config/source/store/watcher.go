@@ -0,0 +1,92 @@
+package store
+
+import (
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/store"
+)
+
+// watcher reads the table again whenever one of its keys changes,
+// stores that can't push changes are polled
+type watcher struct {
+	s   *storeSource
+	w   store.Watcher
+	sum string
+
+	// changed coalesces events so none are lost between calls to Next
+	changed chan bool
+	errs    chan error
+}
+
+func newWatcher(s *storeSource) (source.Watcher, error) {
+	w, err := store.NewWatchStore(s.store, s.interval).Watch(
+		store.WatchFrom(s.database, s.table),
+		store.WatchPrefix(s.prefix),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := s.Read()
+	if err != nil {
+		w.Stop()
+		return nil, err
+	}
+
+	sw := &watcher{
+		s:       s,
+		w:       w,
+		sum:     cs.Checksum,
+		changed: make(chan bool, 1),
+		errs:    make(chan error, 1),
+	}
+	go sw.run()
+	return sw, nil
+}
+
+func (w *watcher) run() {
+	for {
+		// an overflow only means events were missed, the table is read
+		// again either way
+		_, err := w.w.Next()
+		if err != nil && err != store.ErrWatcherOverflow {
+			if err == store.ErrWatcherStopped {
+				err = source.ErrWatcherStopped
+			}
+			w.errs <- err
+			return
+		}
+
+		select {
+		case w.changed <- true:
+		default:
+		}
+	}
+}
+
+func (w *watcher) Next() (*source.ChangeSet, error) {
+	for {
+		select {
+		case <-w.changed:
+		case err := <-w.errs:
+			// keep returning the error
+			w.errs <- err
+			return nil, err
+		}
+
+		cs, err := w.s.Read()
+		if err != nil {
+			return nil, err
+		}
+		if cs.Checksum == w.sum {
+			continue
+		}
+		w.sum = cs.Checksum
+
+		return cs, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.w.Stop()
+	return nil
+}
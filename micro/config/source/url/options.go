@@ -0,0 +1,70 @@
+package url
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+type urlKey struct{}
+type headerKey struct{}
+type httpClientKey struct{}
+type pollIntervalKey struct{}
+type longPollKey struct{}
+type maxBackoffKey struct{}
+type timeoutKey struct{}
+type maxSizeKey struct{}
+
+func setOption(k, v interface{}) source.Option {
+	return func(o *source.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// WithURL sets the endpoint config is fetched from.
+func WithURL(u string) source.Option {
+	return setOption(urlKey{}, u)
+}
+
+// WithHeader sets headers sent with every request, e.g. Authorization.
+func WithHeader(h http.Header) source.Option {
+	return setOption(headerKey{}, h)
+}
+
+// HTTPClient sets the client used for requests.
+func HTTPClient(c *http.Client) source.Option {
+	return setOption(httpClientKey{}, c)
+}
+
+// PollInterval sets how long the watcher waits between conditional GETs.
+func PollInterval(d time.Duration) source.Option {
+	return setOption(pollIntervalKey{}, d)
+}
+
+// LongPoll asks the server to hold requests for up to wait until the
+// config changes, with a Prefer: wait header, and polls again as soon as
+// one returns. A server that answers sooner without a change is polled
+// again once the wait, at most PollInterval, is up.
+func LongPoll(wait time.Duration) source.Option {
+	return setOption(longPollKey{}, wait)
+}
+
+// MaxBackoff caps the jittered backoff after failed requests.
+func MaxBackoff(d time.Duration) source.Option {
+	return setOption(maxBackoffKey{}, d)
+}
+
+// Timeout bounds each request, a long poll may take its wait longer.
+func Timeout(d time.Duration) source.Option {
+	return setOption(timeoutKey{}, d)
+}
+
+// MaxSize sets the largest config, in bytes, read from the url.
+func MaxSize(n int64) source.Option {
+	return setOption(maxSizeKey{}, n)
+}
@@ -0,0 +1,197 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+	"github.com/wxc/micro/config/source/file"
+)
+
+var (
+	DefaultURL          = "http://localhost:8080/config"
+	DefaultPollInterval = time.Second * 30
+	DefaultMaxBackoff   = time.Minute
+	// DefaultTimeout bounds a request, long polls get their wait on top
+	DefaultTimeout = time.Second * 30
+	// DefaultMaxSize is the largest config read from the url
+	DefaultMaxSize int64 = 10 << 20
+)
+
+type urlSource struct {
+	url        string
+	header     http.Header
+	client     *http.Client
+	interval   time.Duration
+	longPoll   time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+	maxSize    int64
+	opts       source.Options
+}
+
+// fetch gets the config, conditionally on the last changeset if given.
+// It returns a nil changeset when the server reports no change.
+func (u *urlSource) fetch(ctx context.Context, last *source.ChangeSet, wait time.Duration) (*source.ChangeSet, error) {
+	if last == nil {
+		wait = 0
+	}
+	// Prefer takes whole seconds, round up so a short wait isn't wait=0
+	if wait > 0 {
+		wait = (wait + time.Second - 1).Truncate(time.Second)
+	}
+	ctx, cancel := context.WithTimeout(ctx, u.timeout+wait)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range u.header {
+		req.Header[k] = v
+	}
+
+	if last != nil {
+		// the checksum is the validator the server sent, if any
+		if v := last.Checksum; strings.HasPrefix(v, `"`) || strings.HasPrefix(v, `W/"`) {
+			req.Header.Set("If-None-Match", v)
+		} else if _, err := http.ParseTime(v); err == nil {
+			req.Header.Set("If-Modified-Since", v)
+		}
+		if wait > 0 {
+			req.Header.Set("Prefer", fmt.Sprintf("wait=%d", int(wait.Seconds())))
+		}
+	}
+
+	rsp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return nil, fmt.Errorf("url: GET %s: %s", u.url, rsp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(rsp.Body, u.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > u.maxSize {
+		return nil, fmt.Errorf("url: GET %s: config is larger than %d bytes", u.url, u.maxSize)
+	}
+
+	cs := &source.ChangeSet{
+		Format:    u.format(rsp.Header.Get("Content-Type")),
+		Source:    u.String(),
+		Timestamp: time.Now(),
+		Data:      b,
+	}
+	if t, err := http.ParseTime(rsp.Header.Get("Last-Modified")); err == nil {
+		cs.Timestamp = t
+	}
+
+	// prefer the validators of the server so conditional requests work
+	switch {
+	case len(rsp.Header.Get("ETag")) > 0:
+		cs.Checksum = rsp.Header.Get("ETag")
+	case len(rsp.Header.Get("Last-Modified")) > 0:
+		cs.Checksum = rsp.Header.Get("Last-Modified")
+	default:
+		cs.Checksum = cs.Sum()
+	}
+
+	return cs, nil
+}
+
+// format maps the content type to a format, falling back to the
+// extension of the url and then the encoder
+func (u *urlSource) format(ct string) string {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		sub := mt[strings.Index(mt, "/")+1:]
+		if i := strings.LastIndex(sub, "+"); i >= 0 {
+			// e.g. application/vnd.app+json
+			sub = sub[i+1:]
+		}
+		sub = strings.TrimPrefix(sub, "x-")
+
+		switch sub {
+		case "json", "toml", "hcl", "xml", "yaml":
+			return sub
+		case "yml":
+			return "yaml"
+		}
+	}
+
+	def := u.opts.Encoder.String()
+	if p, err := url.Parse(u.url); err == nil {
+		return file.Format(p.Path, def)
+	}
+	return def
+}
+
+func (u *urlSource) Read() (*source.ChangeSet, error) {
+	return u.fetch(context.Background(), nil, 0)
+}
+
+func (u *urlSource) Watch() (source.Watcher, error) {
+	return newWatcher(u)
+}
+
+func (u *urlSource) Write(cs *source.ChangeSet) error {
+	return nil
+}
+
+func (u *urlSource) String() string {
+	return "url"
+}
+
+func NewSource(opts ...source.Option) source.Source {
+	options := source.NewOptions(opts...)
+
+	u := &urlSource{
+		url:        DefaultURL,
+		client:     http.DefaultClient,
+		interval:   DefaultPollInterval,
+		maxBackoff: DefaultMaxBackoff,
+		timeout:    DefaultTimeout,
+		maxSize:    DefaultMaxSize,
+		opts:       options,
+	}
+
+	if v, ok := options.Context.Value(urlKey{}).(string); ok {
+		u.url = v
+	}
+	if h, ok := options.Context.Value(headerKey{}).(http.Header); ok {
+		u.header = h
+	}
+	if c, ok := options.Context.Value(httpClientKey{}).(*http.Client); ok {
+		u.client = c
+	}
+	if d, ok := options.Context.Value(pollIntervalKey{}).(time.Duration); ok && d > 0 {
+		u.interval = d
+	}
+	if d, ok := options.Context.Value(longPollKey{}).(time.Duration); ok {
+		u.longPoll = d
+	}
+	if d, ok := options.Context.Value(maxBackoffKey{}).(time.Duration); ok && d > 0 {
+		u.maxBackoff = d
+	}
+	if d, ok := options.Context.Value(timeoutKey{}).(time.Duration); ok && d > 0 {
+		u.timeout = d
+	}
+	if n, ok := options.Context.Value(maxSizeKey{}).(int64); ok && n > 0 {
+		u.maxSize = n
+	}
+
+	return u
+}
@@ -0,0 +1,270 @@
+package url
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+// configServer serves a versioned config with an ETag
+type configServer struct {
+	sync.Mutex
+	version int
+	data    string
+	changed chan struct{}
+
+	requests int32
+	failures int32
+	lastWait string
+}
+
+func newConfigServer(data string) *configServer {
+	return &configServer{version: 1, data: data, changed: make(chan struct{})}
+}
+
+func (c *configServer) set(data string) {
+	c.Lock()
+	c.version++
+	c.data = data
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.Unlock()
+}
+
+func (c *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&c.requests, 1)
+	if atomic.LoadInt32(&c.failures) > 0 {
+		atomic.AddInt32(&c.failures, -1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	c.Lock()
+	etag := fmt.Sprintf(`"v%d"`, c.version)
+	data, changed := c.data, c.changed
+	c.lastWait = r.Header.Get("Prefer")
+	c.Unlock()
+
+	if r.Header.Get("If-None-Match") == etag {
+		// hold long polls until the config changes
+		if len(r.Header.Get("Prefer")) > 0 {
+			select {
+			case <-changed:
+				c.ServeHTTP(w, r)
+				return
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
+	fmt.Fprint(w, data)
+}
+
+func next(t *testing.T, w source.Watcher) *source.ChangeSet {
+	t.Helper()
+
+	done := make(chan *source.ChangeSet, 1)
+	go func() {
+		cs, err := w.Next()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- cs
+	}()
+
+	select {
+	case cs := <-done:
+		return cs
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for change")
+	}
+	return nil
+}
+
+func TestRead(t *testing.T) {
+	cs := newConfigServer("a: 1")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	c, err := NewSource(WithURL(srv.URL)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Format != "yaml" || c.Checksum != `"v1"` || string(c.Data) != "a: 1" {
+		t.Fatalf("unexpected changeset %+v", c)
+	}
+
+	// without a content type the format comes from the path
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil
+		fmt.Fprint(w, "a = 1")
+	}))
+	defer srv2.Close()
+
+	c, err = NewSource(WithURL(srv2.URL + "/app.toml")).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Format != "toml" || c.Checksum != c.Sum() {
+		t.Fatalf("unexpected changeset %+v", c)
+	}
+
+	atomic.StoreInt32(&cs.failures, 1)
+	if _, err := NewSource(WithURL(srv.URL)).Read(); err == nil {
+		t.Fatal("expected error for 503")
+	}
+}
+
+func TestWatchPoll(t *testing.T) {
+	cs := newConfigServer("a: 1")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	w, err := NewSource(WithURL(srv.URL), PollInterval(time.Millisecond*10)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// failures back off and recover
+	atomic.StoreInt32(&cs.failures, 2)
+	cs.set("a: 2")
+
+	if c := next(t, w); string(c.Data) != "a: 2" || c.Checksum != `"v2"` {
+		t.Fatalf("unexpected changeset %+v", c)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != source.ErrWatcherStopped {
+		t.Fatalf("expected ErrWatcherStopped, got %v", err)
+	}
+}
+
+func TestWatchLongPoll(t *testing.T) {
+	cs := newConfigServer("a: 1")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	// a poll interval this long means only a long poll can see the change
+	w, err := NewSource(WithURL(srv.URL), PollInterval(time.Hour), LongPoll(time.Second*30)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cs.set("a: 2")
+	}()
+
+	if c := next(t, w); string(c.Data) != "a: 2" {
+		t.Fatalf("unexpected changeset %+v", c)
+	}
+
+	cs.Lock()
+	prefer := cs.lastWait
+	cs.Unlock()
+	if prefer != "wait=30" {
+		t.Fatalf("expected Prefer: wait=30, got %q", prefer)
+	}
+}
+
+func TestWatchLongPollShort(t *testing.T) {
+	cs := newConfigServer("a: 1")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	w, err := NewSource(WithURL(srv.URL), PollInterval(time.Hour), LongPoll(time.Millisecond*1500)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cs.set("a: 2")
+	}()
+	next(t, w)
+
+	// whole seconds rounded up, never wait=0
+	cs.Lock()
+	prefer := cs.lastWait
+	cs.Unlock()
+	if prefer != "wait=2" {
+		t.Fatalf("expected Prefer: wait=2, got %q", prefer)
+	}
+}
+
+func TestWatchLongPollIgnored(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// answers at once, whatever the Prefer header asks for
+		if len(r.Header.Get("If-None-Match")) > 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "a: 1")
+	}))
+	defer srv.Close()
+
+	w, err := NewSource(WithURL(srv.URL), PollInterval(time.Hour), LongPoll(time.Second*30)).Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go w.Next()
+	time.Sleep(time.Millisecond * 200)
+	w.Stop()
+
+	// the baseline read and a single long poll
+	if n := atomic.LoadInt32(&requests); n > 2 {
+		t.Fatalf("expected at most 2 requests, got %d", n)
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-block:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		fmt.Fprint(w, `{"a": "0123456789"}`)
+	}))
+	defer srv.Close()
+
+	if _, err := NewSource(WithURL(srv.URL), MaxSize(10)).Read(); err == nil {
+		t.Fatal("expected an error reading more than MaxSize")
+	}
+	if _, err := NewSource(WithURL(srv.URL), MaxSize(1024)).Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := NewSource(WithURL(srv.URL+"/slow"), Timeout(time.Millisecond*50)).Read(); err == nil {
+		t.Fatal("expected the request to time out")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("request took %v", d)
+	}
+}
@@ -0,0 +1,114 @@
+package url
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/wxc/micro/config/source"
+)
+
+type watcher struct {
+	u      *urlSource
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	last     *source.ChangeSet
+	failures int
+	// pause is how long to wait after a long poll came back early
+	pause time.Duration
+}
+
+func newWatcher(u *urlSource) (source.Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{
+		u:      u,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// take the current config as the baseline
+	cs, err := u.fetch(ctx, nil, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	w.last = cs
+
+	return w, nil
+}
+
+// backoff returns a random wait, doubling with each failure up to the max
+func (w *watcher) backoff() time.Duration {
+	d := w.u.interval
+	for i := 1; i < w.failures && d < w.u.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.u.maxBackoff {
+		d = w.u.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (w *watcher) sleep(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-w.ctx.Done():
+		return source.ErrWatcherStopped
+	case <-t.C:
+		return nil
+	}
+}
+
+func (w *watcher) Next() (*source.ChangeSet, error) {
+	for {
+		// long polls go straight back to the server
+		if w.u.longPoll <= 0 || w.failures > 0 || w.pause > 0 {
+			wait := w.u.interval
+			switch {
+			case w.failures > 0:
+				wait = w.backoff()
+			case w.pause > 0:
+				wait = w.pause
+			}
+			w.pause = 0
+			if err := w.sleep(wait); err != nil {
+				return nil, err
+			}
+		}
+
+		start := time.Now()
+		cs, err := w.u.fetch(w.ctx, w.last, w.u.longPoll)
+		if w.ctx.Err() != nil {
+			return nil, source.ErrWatcherStopped
+		}
+		if err != nil {
+			w.failures++
+			continue
+		}
+		w.failures = 0
+
+		// not modified, or served again unchanged
+		if cs == nil || cs.Checksum == w.last.Checksum {
+			// a server that doesn't hold the request would be polled
+			// in a tight loop
+			if d := w.u.longPoll - time.Since(start); w.u.longPoll > 0 && d > 0 {
+				if d > w.u.interval {
+					d = w.u.interval
+				}
+				w.pause = d
+			}
+			continue
+		}
+
+		w.last = cs
+		return cs, nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -1,3 +1,15 @@
 module github.com/wxc/micro
 
 go 1.21.2
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/golang/snappy v0.0.4
+	github.com/hashicorp/hcl v1.0.0
+	github.com/klauspost/compress v1.17.4
+	github.com/mattn/go-sqlite3 v1.14.17
+	go.etcd.io/bbolt v1.3.8
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.4.0 // indirect
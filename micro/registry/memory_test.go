@@ -0,0 +1,14 @@
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/wxc/micro/registry"
+	"github.com/wxc/micro/registry/test"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	test.Run(t, func(t testing.TB) registry.Registry {
+		return registry.NewMemoryRegistry()
+	})
+}
@@ -0,0 +1,291 @@
+package test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/registry"
+)
+
+// NewRegistry returns an empty registry for a single test
+type NewRegistry func(t testing.TB) registry.Registry
+
+// Run runs the tests every registry.Registry implementation has to pass
+func Run(t *testing.T, newRegistry NewRegistry) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r registry.Registry)
+	}{
+		{"Register", testRegister},
+		{"Nodes", testNodes},
+		{"Versions", testVersions},
+		{"Watch", testWatch},
+		{"TTL", testTTL},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRegistry(t))
+		})
+	}
+}
+
+func service(name, version string, nodes ...string) *registry.Service {
+	s := &registry.Service{
+		Name:     name,
+		Version:  version,
+		Metadata: map[string]string{"foo": "bar"},
+		Endpoints: []*registry.Endpoint{{
+			Name:     "Greeter.Hello",
+			Request:  &registry.Value{Name: "Request", Type: "Request"},
+			Response: &registry.Value{Name: "Response", Type: "Response"},
+			Metadata: map[string]string{"stream": "false"},
+		}},
+	}
+	for _, n := range nodes {
+		s.Nodes = append(s.Nodes, &registry.Node{
+			Id:       n,
+			Address:  n + ":8080",
+			Metadata: map[string]string{"node": n},
+		})
+	}
+	return s
+}
+
+func nodeIDs(services []*registry.Service) []string {
+	var ids []string
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			ids = append(ids, n.Id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func expectNodes(t *testing.T, r registry.Registry, name string, expect ...string) {
+	t.Helper()
+
+	services, err := r.GetService(name)
+	if len(expect) == 0 {
+		if err != registry.ErrNotFound && len(nodeIDs(services)) > 0 {
+			t.Fatalf("expected no nodes for %s, got %v %v", name, nodeIDs(services), err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+
+	ids := nodeIDs(services)
+	if len(ids) != len(expect) {
+		t.Fatalf("expected nodes %v, got %v", expect, ids)
+	}
+	for i := range ids {
+		if ids[i] != expect[i] {
+			t.Fatalf("expected nodes %v, got %v", expect, ids)
+		}
+	}
+}
+
+func testRegister(t *testing.T, r registry.Registry) {
+	if _, err := r.GetService("test.service"); err != registry.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := r.Register(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("test.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+
+	s := services[0]
+	if s.Name != "test.service" || s.Version != "1.0.0" || s.Metadata["foo"] != "bar" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	if len(s.Endpoints) != 1 || s.Endpoints[0].Name != "Greeter.Hello" || s.Endpoints[0].Request.Type != "Request" {
+		t.Fatalf("unexpected endpoints %+v", s.Endpoints)
+	}
+	if len(s.Nodes) != 1 || s.Nodes[0].Address != "node-1:8080" || s.Nodes[0].Metadata["node"] != "node-1" {
+		t.Fatalf("unexpected nodes %+v", s.Nodes)
+	}
+
+	// registering again is a heartbeat, not a new node
+	if err := r.Register(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service", "node-1")
+
+	if err := r.Register(service("other.service", "1.0.0", "node-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range list {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "other.service" || names[1] != "test.service" {
+		t.Fatalf("unexpected services %v", names)
+	}
+
+	if err := r.Deregister(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service")
+	expectNodes(t, r, "other.service", "node-2")
+}
+
+func testNodes(t *testing.T, r registry.Registry) {
+	if err := r.Register(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(service("test.service", "1.0.0", "node-2", "node-3")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service", "node-1", "node-2", "node-3")
+
+	if err := r.Deregister(service("test.service", "1.0.0", "node-2")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service", "node-1", "node-3")
+
+	if err := r.Deregister(service("test.service", "1.0.0", "node-1", "node-3")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service")
+}
+
+func testVersions(t *testing.T, r registry.Registry) {
+	if err := r.Register(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(service("test.service", "2.0.0", "node-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := r.GetService("test.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, s := range services {
+		versions = append(versions, s.Version)
+	}
+	sort.Strings(versions)
+	if len(versions) != 2 || versions[0] != "1.0.0" || versions[1] != "2.0.0" {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+
+	// deregistering one version leaves the other
+	if err := r.Deregister(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	expectNodes(t, r, "test.service", "node-2")
+}
+
+func testWatch(t *testing.T, r registry.Registry) {
+	w, err := r.Watch(registry.WatchService("test.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	results := make(chan *registry.Result, 10)
+	go func() {
+		for {
+			res, err := w.Next()
+			if err != nil {
+				close(results)
+				return
+			}
+			results <- res
+		}
+	}()
+
+	// give the watcher time to start waiting
+	time.Sleep(time.Millisecond * 10)
+
+	next := func(actions ...string) {
+		t.Helper()
+		select {
+		case res, ok := <-results:
+			if !ok {
+				t.Fatal("watcher stopped")
+			}
+			if res.Service.Name != "test.service" {
+				t.Fatalf("unexpected service %s", res.Service.Name)
+			}
+			for _, a := range actions {
+				if res.Action == a {
+					return
+				}
+			}
+			t.Fatalf("expected one of %v, got %s", actions, res.Action)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for %v", actions)
+		}
+	}
+
+	if err := r.Register(service("other.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	next("create", "update")
+
+	if err := r.Deregister(service("test.service", "1.0.0", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	next("delete")
+
+	w.Stop()
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Fatal("unexpected result after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next did not return after Stop")
+	}
+}
+
+func testTTL(t *testing.T, r registry.Registry) {
+	ttl := time.Millisecond * 100
+
+	if err := r.Register(service("test.service", "1.0.0", "node-1"), registry.RegisterTTL(ttl)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(service("test.service", "1.0.0", "node-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// implementations prune on their own schedule
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		services, err := r.GetService("test.service")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := nodeIDs(services)
+		if len(ids) == 1 && ids[0] == "node-2" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected node-1 to expire, got %v", ids)
+		}
+		time.Sleep(ttl)
+	}
+}
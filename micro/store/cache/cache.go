@@ -0,0 +1,626 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	DefaultTTL           = time.Minute
+	DefaultFlushInterval = time.Second
+	// how often keys known to be missing or recently changed are swept
+	DefaultSweepInterval = time.Minute
+
+	// the version and expiry of a record in the slow store while it is cached
+	cachedVersionKey = "micro.cache.version"
+	cachedExpiryKey  = "micro.cache.expiry"
+)
+
+type Options struct {
+	TTL         time.Duration
+	TableTTL    map[string]time.Duration
+	NegativeTTL time.Duration
+
+	WriteBehind   bool
+	FlushInterval time.Duration
+	// PollInterval is how often a slow store that can't push its
+	// changes is polled for them
+	PollInterval time.Duration
+
+	Logger logger.Logger
+}
+
+type Option func(o *Options)
+
+type cacheStore struct {
+	opts Options
+	fast store.Store
+	slow store.Store
+
+	sync.Mutex
+	// keys the slow store doesn't have, until when
+	missing map[string]time.Time
+	// the oldest version of a key still current in the slow store after
+	// a write or change, so a read which raced it doesn't cache what it
+	// replaced
+	changed map[string]change
+	// orders filling the fast store against invalidating it
+	filling sync.Mutex
+	// writes and deletes not yet in the slow store
+	pending []*pendingOp
+	// tables whose changes are being watched
+	watched  map[string]store.Watcher
+	exit     chan bool
+	flushing sync.Mutex
+}
+
+type change struct {
+	version uint64
+	at      time.Time
+}
+
+type pendingOp struct {
+	record *store.Record
+	key    string
+	write  store.WriteOptions
+	delete store.DeleteOptions
+	// when the record expires, fixed when it was written
+	expires time.Time
+}
+
+func (c *cacheStore) names(database, table string) (string, string) {
+	if len(database) == 0 {
+		database = c.slow.Options().Database
+	}
+	if len(table) == 0 {
+		table = c.slow.Options().Table
+	}
+	return database, table
+}
+
+func (c *cacheStore) ttl(database, table string) time.Duration {
+	if t, ok := c.opts.TableTTL[database+"/"+table]; ok {
+		return t
+	}
+	return c.opts.TTL
+}
+
+func (c *cacheStore) isMissing(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	until, ok := c.missing[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(c.missing, id)
+		return false
+	}
+	return true
+}
+
+func (c *cacheStore) setMissing(id string, missing bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !missing {
+		delete(c.missing, id)
+		return
+	}
+	if c.opts.NegativeTTL > 0 {
+		c.missing[id] = time.Now().Add(c.opts.NegativeTTL)
+	}
+}
+
+// changedTo records that versions of a key below version are stale
+func (c *cacheStore) changedTo(id string, version uint64) {
+	if version == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.changed[id].version < version {
+		c.changed[id] = change{version: version, at: time.Now()}
+	}
+}
+
+// cached returns the slow store version of the cached copy of key
+func (c *cacheStore) cached(database, table, key string) uint64 {
+	recs, err := c.fast.Read(key, store.ReadFrom(database, table))
+	if err != nil || len(recs) == 0 {
+		return 0
+	}
+	return store.Version(hit(recs[0]))
+}
+
+// changedBy drops the cached copy of a record changed in the slow store,
+// unless it is already the version of the change or a later one
+func (c *cacheStore) changedBy(database, table string, e *store.Event) {
+	id := database + "/" + table + "/" + e.Record.Key
+
+	// the oldest version still current, a deleted one is gone too
+	current := store.Version(e.Record)
+	if current > 0 && e.Type != store.Create && e.Type != store.Update {
+		current++
+	}
+
+	c.filling.Lock()
+	defer c.filling.Unlock()
+
+	c.changedTo(id, current)
+
+	// usually the fill made by a write through this cache
+	if current > 0 && c.cached(database, table, e.Record.Key) >= current {
+		return
+	}
+
+	c.fast.Delete(e.Record.Key, store.DeleteFrom(database, table))
+	c.setMissing(id, false)
+}
+
+// sweep drops the missing keys which are due and the changes old enough
+// that no read can still be racing them
+func (c *cacheStore) sweep(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-c.exit:
+			return
+		}
+
+		now := time.Now()
+		c.Lock()
+		for id, until := range c.missing {
+			if now.After(until) {
+				delete(c.missing, id)
+			}
+		}
+		for id, ch := range c.changed {
+			if now.Sub(ch.at) > interval {
+				delete(c.changed, id)
+			}
+		}
+		c.Unlock()
+	}
+}
+
+// watch invalidates the fast store on changes to a table of the slow
+// store, stores that can't push them are polled
+func (c *cacheStore) watch(database, table string) {
+	ws := store.NewWatchStore(c.slow, c.opts.PollInterval)
+	id := database + "/" + table
+
+	c.Lock()
+	if _, ok := c.watched[id]; ok {
+		c.Unlock()
+		return
+	}
+	w, err := ws.Watch(store.WatchFrom(database, table))
+	if err != nil {
+		c.Unlock()
+		c.logf("Failed to watch %s: %v", id, err)
+		return
+	}
+	c.watched[id] = w
+	c.Unlock()
+
+	go func() {
+		for {
+			e, err := w.Next()
+			if err == store.ErrWatcherOverflow {
+				// changes were dropped, any record may be stale
+				c.invalidate(database, table)
+				continue
+			}
+			if err != nil {
+				return
+			}
+			c.changedBy(database, table, e)
+		}
+	}()
+}
+
+// invalidate drops everything cached for a table
+func (c *cacheStore) invalidate(database, table string) {
+	prefix := database + "/" + table + "/"
+
+	c.Lock()
+	for id := range c.missing {
+		if strings.HasPrefix(id, prefix) {
+			delete(c.missing, id)
+		}
+	}
+	c.Unlock()
+
+	keys, err := c.fast.List(store.ListFrom(database, table))
+	if err != nil {
+		c.logf("Failed to invalidate %s/%s: %v", database, table, err)
+		return
+	}
+	for _, k := range keys {
+		c.fast.Delete(k, store.DeleteFrom(database, table))
+	}
+}
+
+// fill caches a record read from the slow store, unless the slow store
+// or the cache has already moved on to a later version of it
+func (c *cacheStore) fill(database, table string, r *store.Record) {
+	c.filling.Lock()
+	defer c.filling.Unlock()
+
+	if v := store.Version(r); v > 0 {
+		c.Lock()
+		last := c.changed[database+"/"+table+"/"+r.Key].version
+		c.Unlock()
+		if v < last || v < c.cached(database, table, r.Key) {
+			return
+		}
+	}
+
+	ttl := c.ttl(database, table)
+	if r.Expiry > 0 && (ttl <= 0 || r.Expiry < ttl) {
+		ttl = r.Expiry
+	}
+
+	rec := &store.Record{
+		Key:      r.Key,
+		Value:    r.Value,
+		Metadata: make(map[string]interface{}),
+		Expiry:   ttl,
+	}
+	for k, v := range r.Metadata {
+		rec.Metadata[k] = v
+	}
+	delete(rec.Metadata, store.VersionKey)
+	if v := store.Version(r); v > 0 {
+		rec.Metadata[cachedVersionKey] = v
+	}
+	if r.Expiry > 0 {
+		rec.Metadata[cachedExpiryKey] = time.Now().Add(r.Expiry).Format(time.RFC3339Nano)
+	}
+
+	if err := c.fast.Write(rec, store.WriteTo(database, table)); err != nil {
+		c.logf("Failed to cache %s: %v", r.Key, err)
+	}
+}
+
+// hit turns a record from the fast store back into the slow store's
+func hit(r *store.Record) *store.Record {
+	delete(r.Metadata, store.VersionKey)
+	if v, ok := r.Metadata[cachedVersionKey]; ok {
+		r.Metadata[store.VersionKey] = v
+		delete(r.Metadata, cachedVersionKey)
+	}
+
+	// the expiry of the cached copy is only how long it is cached for
+	r.Expiry = 0
+	if v, ok := r.Metadata[cachedExpiryKey].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			r.Expiry = time.Until(t)
+		}
+		delete(r.Metadata, cachedExpiryKey)
+	}
+	return r
+}
+
+func (c *cacheStore) logf(format string, v ...interface{}) {
+	logger.LoggerOrDefault(c.opts.Logger).Logf(logger.ErrorLevel, format, v...)
+}
+
+// flush writes the pending ops to the slow store in order
+func (c *cacheStore) flush() error {
+	return c.flushOps(func(*pendingOp) bool { return true })
+}
+
+// flushKey writes only the pending ops of a single key
+func (c *cacheStore) flushKey(database, table, key string) error {
+	return c.flushOps(func(op *pendingOp) bool {
+		if op.record != nil {
+			return op.record.Key == key && op.write.Database == database && op.write.Table == table
+		}
+		return op.key == key && op.delete.Database == database && op.delete.Table == table
+	})
+}
+
+// flushOps writes the pending ops matching fn to the slow store in order,
+// the copies it wrote are dropped from the fast store so the next read
+// picks up the version the slow store gave them
+func (c *cacheStore) flushOps(fn func(*pendingOp) bool) error {
+	c.flushing.Lock()
+	defer c.flushing.Unlock()
+
+	var ops, rest []*pendingOp
+	c.Lock()
+	for _, op := range c.pending {
+		if fn(op) {
+			ops = append(ops, op)
+		} else {
+			rest = append(rest, op)
+		}
+	}
+	c.pending = rest
+	c.Unlock()
+
+	for i, op := range ops {
+		var err error
+		switch {
+		case op.record != nil && op.expires.IsZero():
+			err = c.slow.Write(op.record, store.WriteTo(op.write.Database, op.write.Table))
+		case op.record != nil && time.Now().Before(op.expires):
+			err = c.slow.Write(op.record, store.WriteTo(op.write.Database, op.write.Table), store.WriteExpiry(op.expires))
+		case op.record != nil:
+			// expired before it was flushed, it still replaces the old record
+			err = c.slow.Delete(op.record.Key, store.DeleteFrom(op.write.Database, op.write.Table))
+		default:
+			err = c.slow.Delete(op.key, store.DeleteFrom(op.delete.Database, op.delete.Table))
+		}
+		if err != nil {
+			// keep the rest for the next flush
+			c.Lock()
+			c.pending = append(ops[i:], c.pending...)
+			c.Unlock()
+			return err
+		}
+		if op.record != nil {
+			c.fast.Delete(op.record.Key, store.DeleteFrom(op.write.Database, op.write.Table))
+		}
+	}
+
+	return nil
+}
+
+func (c *cacheStore) run() {
+	t := time.NewTicker(c.opts.FlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.flush(); err != nil {
+				c.logf("Failed to flush writes: %v", err)
+			}
+		case <-c.exit:
+			return
+		}
+	}
+}
+
+func (c *cacheStore) Init(opts ...store.Option) error {
+	return c.slow.Init(opts...)
+}
+
+func (c *cacheStore) Options() store.Options {
+	return c.slow.Options()
+}
+
+func (c *cacheStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	var readOpts store.ReadOptions
+	for _, o := range opts {
+		o(&readOpts)
+	}
+
+	database, table := c.names(readOpts.Database, readOpts.Table)
+	c.watch(database, table)
+
+	// the fast store can't know it holds every match, go to the slow
+	// store and cache the records one by one
+	if readOpts.Prefix || readOpts.Suffix {
+		if c.opts.WriteBehind {
+			if err := c.flush(); err != nil {
+				return nil, err
+			}
+		}
+
+		recs, err := c.slow.Read(key, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			c.fill(database, table, r)
+		}
+		return recs, nil
+	}
+
+	id := database + "/" + table + "/" + key
+	if c.isMissing(id) {
+		return nil, store.ErrNotFound
+	}
+
+	if recs, err := c.fast.Read(key, store.ReadFrom(database, table)); err == nil && len(recs) > 0 {
+		return []*store.Record{hit(recs[0])}, nil
+	}
+
+	// a pending delete must not be read back from the slow store
+	if c.opts.WriteBehind {
+		if err := c.flushKey(database, table, key); err != nil {
+			return nil, err
+		}
+	}
+
+	recs, err := c.slow.Read(key, opts...)
+	if err == store.ErrNotFound {
+		c.setMissing(id, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range recs {
+		c.fill(database, table, r)
+	}
+
+	return recs, nil
+}
+
+func (c *cacheStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	var writeOpts store.WriteOptions
+	for _, o := range opts {
+		o(&writeOpts)
+	}
+
+	database, table := c.names(writeOpts.Database, writeOpts.Table)
+	writeOpts.Database, writeOpts.Table = database, table
+	c.setMissing(database+"/"+table+"/"+r.Key, false)
+
+	// a conditional write has to be checked by the slow store now
+	conditional := writeOpts.IfVersion > 0 || writeOpts.IfNotExists
+
+	if !c.opts.WriteBehind || conditional {
+		if c.opts.WriteBehind {
+			if err := c.flush(); err != nil {
+				return err
+			}
+		}
+		if err := c.slow.Write(r, opts...); err != nil {
+			return err
+		}
+		// cache the record with the version the slow store gave it, a
+		// copy without one would turn WriteIfVersion into a blind write
+		recs, err := c.slow.Read(r.Key, store.ReadFrom(database, table))
+		if err != nil || len(recs) == 0 {
+			return c.fast.Delete(r.Key, store.DeleteFrom(database, table))
+		}
+		c.changedTo(database+"/"+table+"/"+r.Key, store.Version(recs[0]))
+		c.fill(database, table, recs[0])
+		return nil
+	}
+
+	rec := &store.Record{Key: r.Key, Value: r.Value, Metadata: r.Metadata, Expiry: c.expiry(r, writeOpts)}
+	c.fill(database, table, rec)
+
+	op := &pendingOp{record: rec, write: writeOpts}
+	if rec.Expiry != 0 {
+		op.expires = time.Now().Add(rec.Expiry)
+	}
+	rec.Expiry = 0
+
+	c.Lock()
+	c.pending = append(c.pending, op)
+	c.Unlock()
+
+	return nil
+}
+
+func (c *cacheStore) expiry(r *store.Record, opts store.WriteOptions) time.Duration {
+	expiry := r.Expiry
+	if !opts.Expiry.IsZero() {
+		expiry = time.Until(opts.Expiry)
+	}
+	if opts.TTL != 0 {
+		expiry = opts.TTL
+	}
+	return expiry
+}
+
+func (c *cacheStore) Delete(key string, opts ...store.DeleteOption) error {
+	var deleteOpts store.DeleteOptions
+	for _, o := range opts {
+		o(&deleteOpts)
+	}
+
+	database, table := c.names(deleteOpts.Database, deleteOpts.Table)
+	deleteOpts.Database, deleteOpts.Table = database, table
+
+	if !c.opts.WriteBehind || deleteOpts.IfVersion > 0 {
+		if c.opts.WriteBehind {
+			if err := c.flush(); err != nil {
+				return err
+			}
+		}
+		if err := c.slow.Delete(key, opts...); err != nil {
+			return err
+		}
+		return c.fast.Delete(key, store.DeleteFrom(database, table))
+	}
+
+	if err := c.fast.Delete(key, store.DeleteFrom(database, table)); err != nil {
+		return err
+	}
+
+	c.Lock()
+	c.pending = append(c.pending, &pendingOp{key: key, delete: deleteOpts})
+	c.Unlock()
+
+	return nil
+}
+
+func (c *cacheStore) List(opts ...store.ListOption) ([]string, error) {
+	if c.opts.WriteBehind {
+		if err := c.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return c.slow.List(opts...)
+}
+
+func (c *cacheStore) Close() error {
+	c.Lock()
+	select {
+	case <-c.exit:
+		c.Unlock()
+		return nil
+	default:
+		close(c.exit)
+	}
+	for id, w := range c.watched {
+		w.Stop()
+		delete(c.watched, id)
+	}
+	c.Unlock()
+
+	err := c.flush()
+	if cerr := c.fast.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := c.slow.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *cacheStore) String() string {
+	return "cache"
+}
+
+// NewStore puts fast in front of slow. Reads are served from fast where
+// possible and writes go through to slow, or behind it with WriteBehind.
+func NewStore(fast, slow store.Store, opts ...Option) store.Store {
+	options := Options{
+		TTL:           DefaultTTL,
+		FlushInterval: DefaultFlushInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+
+	c := &cacheStore{
+		opts:    options,
+		fast:    fast,
+		slow:    slow,
+		missing: make(map[string]time.Time),
+		changed: make(map[string]change),
+		watched: make(map[string]store.Watcher),
+		exit:    make(chan bool),
+	}
+
+	go c.sweep(DefaultSweepInterval)
+
+	if options.WriteBehind {
+		go c.run()
+	}
+
+	return c
+}
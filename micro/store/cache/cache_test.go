@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+// countStore counts the reads reaching the slow store
+type countStore struct {
+	store.WatchStore
+	reads int32
+}
+
+func (c *countStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	atomic.AddInt32(&c.reads, 1)
+	return c.WatchStore.Read(key, opts...)
+}
+
+func newSlow() *countStore {
+	return &countStore{WatchStore: store.NewMemoryStore().(store.WatchStore)}
+}
+
+func TestReadThrough(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow, NegativeTTL(time.Minute))
+	defer c.Close()
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("bar")})
+
+	for i := 0; i < 3; i++ {
+		recs, err := c.Read("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(recs[0].Value) != "bar" {
+			t.Fatalf("unexpected value %s", recs[0].Value)
+		}
+		if store.Version(recs[0]) != 1 {
+			t.Fatalf("expected the slow store version, got %d", store.Version(recs[0]))
+		}
+	}
+	if n := atomic.LoadInt32(&slow.reads); n != 1 {
+		t.Fatalf("expected 1 slow read, got %d", n)
+	}
+
+	// not found is cached too
+	for i := 0; i < 3; i++ {
+		if _, err := c.Read("missing"); err != store.ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&slow.reads); n != 2 {
+		t.Fatalf("expected 2 slow reads, got %d", n)
+	}
+
+	if err := c.Write(&store.Record{Key: "missing", Value: []byte("found")}); err != nil {
+		t.Fatal(err)
+	}
+	if recs, err := c.Read("missing"); err != nil || string(recs[0].Value) != "found" {
+		t.Fatalf("unexpected read after write %v %v", recs, err)
+	}
+
+	// changes made to the slow store directly invalidate the cache
+	slow.Write(&store.Record{Key: "foo", Value: []byte("baz")})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		recs, err := c.Read("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(recs[0].Value) == "baz" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not invalidated")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// prefix reads go to the slow store
+	slow.Write(&store.Record{Key: "foobar", Value: []byte("foobar")})
+	recs, err := c.Read("foo", store.ReadPrefix(), store.ReadLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+}
+
+func TestWriteThroughVersion(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow)
+	defer c.Close()
+
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := c.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := store.Version(recs[0])
+	if v == 0 {
+		t.Fatal("expected the cached record to carry the slow store version")
+	}
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("baz")})
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("stale")}, store.WriteIfVersion(v)); err != store.ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestWriteThroughInvalidation(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow)
+	defer c.Close()
+
+	// start watching the table
+	c.Read("foo")
+
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	reads := atomic.LoadInt32(&slow.reads)
+
+	// the event for the write leaves the copy it cached alone
+	time.Sleep(time.Millisecond * 50)
+	if recs, err := c.Read("foo"); err != nil || string(recs[0].Value) != "bar" {
+		t.Fatalf("unexpected read %v %v", recs, err)
+	}
+	if n := atomic.LoadInt32(&slow.reads); n != reads {
+		t.Fatalf("expected the write to stay cached, got %d slow reads", n-reads)
+	}
+}
+
+func TestStaleFill(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow).(*cacheStore)
+	defer c.Close()
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("old")})
+	old, err := slow.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a read of the old version finishing after a write doesn't cache it
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	c.fast.Delete("foo", store.DeleteFrom("micro", "micro"))
+	c.fill("micro", "micro", old[0])
+
+	recs, err := c.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recs[0].Value) != "new" {
+		t.Fatalf("expected new got %s", recs[0].Value)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	interval := DefaultSweepInterval
+	DefaultSweepInterval = time.Millisecond * 10
+	defer func() { DefaultSweepInterval = interval }()
+
+	c := NewStore(store.NewMemoryStore(), newSlow(), NegativeTTL(time.Millisecond)).(*cacheStore)
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.Read(key); err != store.ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	c.Lock()
+	n := len(c.missing)
+	c.Unlock()
+	if n != 0 {
+		t.Fatalf("expected missing keys to be swept, got %d", n)
+	}
+}
+
+// plainStore hides the watch support of the store it wraps
+type plainStore struct {
+	store.Store
+}
+
+func TestPollInvalidation(t *testing.T) {
+	slow := plainStore{store.NewMemoryStore()}
+	c := NewStore(store.NewMemoryStore(), slow, PollInterval(time.Millisecond*10))
+	defer c.Close()
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("bar")})
+	if _, err := c.Read("foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("baz")})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		recs, err := c.Read("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(recs[0].Value) == "baz" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not invalidated")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestTableTTL(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow, TableTTL("micro", "short", time.Millisecond*20))
+	defer c.Close()
+
+	slow.Write(&store.Record{Key: "foo", Value: []byte("bar")}, store.WriteTo("micro", "short"))
+
+	c.Read("foo", store.ReadFrom("micro", "short"))
+	c.Read("foo", store.ReadFrom("micro", "short"))
+	time.Sleep(time.Millisecond * 40)
+	c.Read("foo", store.ReadFrom("micro", "short"))
+
+	if n := atomic.LoadInt32(&slow.reads); n != 2 {
+		t.Fatalf("expected 2 slow reads, got %d", n)
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	slow := newSlow()
+	c := NewStore(store.NewMemoryStore(), slow, WriteBehind(time.Hour))
+
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(&store.Record{Key: "gone", Value: []byte("gone")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := slow.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected the write to be pending, got %v", err)
+	}
+	if recs, err := c.Read("foo"); err != nil || string(recs[0].Value) != "bar" {
+		t.Fatalf("unexpected read %v %v", recs, err)
+	}
+
+	// a miss only flushes the key it missed
+	if _, err := c.Read("other"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := slow.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected the write to still be pending, got %v", err)
+	}
+
+	// conditional writes are not deferred, the pending ones go first
+	if err := c.Write(&store.Record{Key: "foo", Value: []byte("new")}, store.WriteIfNotExists()); err != store.ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	if recs, err := slow.Read("foo"); err != nil || string(recs[0].Value) != "bar" {
+		t.Fatalf("unexpected slow read %v %v", recs, err)
+	}
+	if _, err := slow.Read("gone"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheConformance(t *testing.T) {
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.NewMemoryStore(), newSlow(), NegativeTTL(time.Minute))
+	})
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.NewMemoryStore(), newSlow(), WriteBehind(time.Hour))
+	})
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/wxc/micro/logger"
+)
+
+// WithTTL sets how long records stay in the fast store
+func WithTTL(t time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = t
+	}
+}
+
+// TableTTL overrides the TTL for a single database/table
+func TableTTL(database, table string, t time.Duration) Option {
+	return func(o *Options) {
+		if o.TableTTL == nil {
+			o.TableTTL = make(map[string]time.Duration)
+		}
+		o.TableTTL[database+"/"+table] = t
+	}
+}
+
+// NegativeTTL caches store.ErrNotFound from the slow store for t
+func NegativeTTL(t time.Duration) Option {
+	return func(o *Options) {
+		o.NegativeTTL = t
+	}
+}
+
+// WriteBehind acknowledges writes once they are in the fast store and
+// writes them to the slow store every interval. Records read before they
+// are written to the slow store have no version yet.
+func WriteBehind(interval time.Duration) Option {
+	return func(o *Options) {
+		o.WriteBehind = true
+		o.FlushInterval = interval
+	}
+}
+
+// PollInterval sets how often a slow store that can't push its changes
+// is polled for them, so the records cached from it are invalidated
+func PollInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.PollInterval = d
+	}
+}
+
+func WithLogger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -0,0 +1,20 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+func TestMemoryStore(t *testing.T) {
+	test.Run(t, func(t testing.TB) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+func BenchmarkMemoryStore(b *testing.B) {
+	test.Bench(b, func(t testing.TB) store.Store {
+		return store.NewMemoryStore()
+	})
+}
@@ -0,0 +1,412 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/wxc/micro/store"
+)
+
+var (
+	// MetadataKeyID holds the id of the key a record was encrypted with
+	MetadataKeyID = "micro.encrypt.key_id"
+	// MetadataKey holds the encrypted record key when keys are hashed
+	MetadataKey = "micro.encrypt.key"
+
+	ErrNotEncryptedStore = errors.New("not an encrypted store")
+	ErrNotEncrypted      = errors.New("record is not encrypted")
+	ErrNoKeyMode         = errors.New("encrypt: HashKeys or PlaintextKeys has to be set")
+)
+
+type encryptStore struct {
+	store.Store
+	keys KeyProvider
+	opts Options
+}
+
+func (e *encryptStore) seal(key []byte, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (e *encryptStore) open(id string, ciphertext, aad []byte) ([]byte, error) {
+	key, err := e.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// hash returns the key as it is stored in the underlying store
+func (e *encryptStore) hash(key string) string {
+	if len(e.opts.HashKey) == 0 {
+		return key
+	}
+	h := hmac.New(sha256.New, e.opts.HashKey)
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *encryptStore) encrypt(r *store.Record) (*store.Record, error) {
+	id, key, err := e.keys.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &store.Record{
+		Key:      e.hash(r.Key),
+		Metadata: make(map[string]interface{}),
+		Expiry:   r.Expiry,
+	}
+	for k, v := range r.Metadata {
+		rec.Metadata[k] = v
+	}
+	rec.Metadata[MetadataKeyID] = id
+
+	// the value is bound to its key so it can't be moved to another
+	if rec.Value, err = e.seal(key, r.Value, []byte(r.Key)); err != nil {
+		return nil, err
+	}
+
+	if rec.Key != r.Key {
+		k, err := e.seal(key, []byte(r.Key), []byte(rec.Key))
+		if err != nil {
+			return nil, err
+		}
+		rec.Metadata[MetadataKey] = base64.StdEncoding.EncodeToString(k)
+	}
+
+	return rec, nil
+}
+
+// decrypt reverses encrypt, records written before the store was
+// encrypted are only returned as they are when migrating
+func (e *encryptStore) decrypt(r *store.Record) (*store.Record, error) {
+	id, ok := r.Metadata[MetadataKeyID].(string)
+	if !ok {
+		if e.opts.Migrate {
+			return r, nil
+		}
+		return nil, ErrNotEncrypted
+	}
+
+	rec := &store.Record{
+		Key:      r.Key,
+		Metadata: make(map[string]interface{}),
+		Expiry:   r.Expiry,
+	}
+	for k, v := range r.Metadata {
+		rec.Metadata[k] = v
+	}
+	delete(rec.Metadata, MetadataKeyID)
+	delete(rec.Metadata, MetadataKey)
+
+	if enc, ok := r.Metadata[MetadataKey].(string); ok {
+		k, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = e.open(id, k, []byte(r.Key)); err != nil {
+			return nil, err
+		}
+		rec.Key = string(k)
+	}
+
+	v, err := e.open(id, r.Value, []byte(rec.Key))
+	if err != nil {
+		return nil, err
+	}
+	rec.Value = v
+
+	return rec, nil
+}
+
+// check refuses to run until the caller picked how keys are stored
+func (e *encryptStore) check() error {
+	if len(e.opts.HashKey) == 0 && !e.opts.PlaintextKeys {
+		return ErrNoKeyMode
+	}
+	return nil
+}
+
+func (e *encryptStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+
+	var readOpts store.ReadOptions
+	for _, o := range opts {
+		o(&readOpts)
+	}
+
+	// hashed keys can't be matched on, find the keys first
+	if len(e.opts.HashKey) > 0 && (readOpts.Prefix || readOpts.Suffix) {
+		listOpts := []store.ListOption{
+			store.ListFrom(readOpts.Database, readOpts.Table),
+			store.ListLimit(readOpts.Limit),
+			store.ListOffset(readOpts.Offset),
+			store.ListCursor(readOpts.Cursor),
+		}
+		if readOpts.Prefix {
+			listOpts = append(listOpts, store.ListPrefix(key))
+		}
+		if readOpts.Suffix {
+			listOpts = append(listOpts, store.ListSuffix(key))
+		}
+
+		keys, err := e.List(listOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		var records []*store.Record
+		for _, k := range keys {
+			recs, err := e.Read(k, store.ReadFrom(readOpts.Database, readOpts.Table))
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, recs...)
+		}
+		return records, nil
+	}
+
+	recs, err := e.Store.Read(e.hash(key), opts...)
+	if err == store.ErrNotFound && e.opts.Migrate && e.hash(key) != key {
+		// written before keys were hashed
+		recs, err = e.Store.Read(key, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*store.Record, 0, len(recs))
+	for _, r := range recs {
+		rec, err := e.decrypt(r)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+func (e *encryptStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	rec, err := e.encrypt(r)
+	if err != nil {
+		return err
+	}
+	return e.Store.Write(rec, opts...)
+}
+
+func (e *encryptStore) Delete(key string, opts ...store.DeleteOption) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	return e.Store.Delete(e.hash(key), opts...)
+}
+
+func (e *encryptStore) List(opts ...store.ListOption) ([]string, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	if len(e.opts.HashKey) == 0 {
+		return e.Store.List(opts...)
+	}
+
+	var listOpts store.ListOptions
+	for _, o := range opts {
+		o(&listOpts)
+	}
+
+	hashed, err := e.Store.List(store.ListFrom(listOpts.Database, listOpts.Table))
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := store.DecodeCursor(listOpts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, h := range hashed {
+		recs, err := e.Store.Read(h, store.ReadFrom(listOpts.Database, listOpts.Table))
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec, err := e.decrypt(recs[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(listOpts.Cursor) > 0 && rec.Key <= after {
+			continue
+		}
+		if strings.HasPrefix(rec.Key, listOpts.Prefix) && strings.HasSuffix(rec.Key, listOpts.Suffix) {
+			keys = append(keys, rec.Key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	if listOpts.Offset >= uint(len(keys)) {
+		return nil, nil
+	}
+	keys = keys[listOpts.Offset:]
+	if listOpts.Limit > 0 && listOpts.Limit < uint(len(keys)) {
+		keys = keys[:listOpts.Limit]
+	}
+
+	return keys, nil
+}
+
+func (e *encryptStore) String() string {
+	return "encrypt"
+}
+
+// Reencrypt rewrites the records matching opts which aren't encrypted
+// with the current key, including records written before the store was
+// encrypted, returning how many it rewrote. Records changed while it
+// runs are left to the writer where the store supports
+// store.WriteIfVersion.
+func Reencrypt(s store.Store, opts ...store.ListOption) (int, error) {
+	es, ok := s.(*encryptStore)
+	if !ok {
+		return 0, ErrNotEncryptedStore
+	}
+	if err := es.check(); err != nil {
+		return 0, err
+	}
+
+	// plaintext records are what it is here to migrate
+	e := &encryptStore{Store: es.Store, keys: es.keys, opts: es.opts}
+	e.opts.Migrate = true
+
+	current, _, err := e.keys.Current()
+	if err != nil {
+		return 0, err
+	}
+
+	var listOpts store.ListOptions
+	for _, o := range opts {
+		o(&listOpts)
+	}
+
+	keys, err := e.List(opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+
+	for _, key := range keys {
+		stored := e.hash(key)
+		recs, err := e.Store.Read(stored, store.ReadFrom(listOpts.Database, listOpts.Table))
+		if err == store.ErrNotFound && stored != key {
+			// written before keys were hashed
+			stored = key
+			recs, err = e.Store.Read(stored, store.ReadFrom(listOpts.Database, listOpts.Table))
+		}
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if id, _ := recs[0].Metadata[MetadataKeyID].(string); id == current {
+			continue
+		}
+
+		rec, err := e.decrypt(recs[0])
+		if err != nil {
+			return n, err
+		}
+		delete(rec.Metadata, store.VersionKey)
+
+		writeOpts := []store.WriteOption{store.WriteTo(listOpts.Database, listOpts.Table)}
+		if v := store.Version(recs[0]); v > 0 {
+			writeOpts = append(writeOpts, store.WriteIfVersion(v))
+		}
+
+		err = e.Write(rec, writeOpts...)
+		if err == store.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if stored != e.hash(key) {
+			if err := e.Store.Delete(stored, store.DeleteFrom(listOpts.Database, listOpts.Table)); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// NewStore encrypts the values written to s with AES-GCM using keys
+// from the provider. HashKeys or PlaintextKeys has to be passed to pick
+// how record keys are stored.
+func NewStore(s store.Store, keys KeyProvider, opts ...Option) store.Store {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &encryptStore{
+		Store: s,
+		keys:  keys,
+		opts:  options,
+	}
+}
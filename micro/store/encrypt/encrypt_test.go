@@ -0,0 +1,160 @@
+package encrypt
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+func TestEncrypt(t *testing.T) {
+	for _, hashed := range []bool{false, true} {
+		backend := store.NewMemoryStore()
+
+		keys := map[string][]byte{"v1": bytes.Repeat([]byte("a"), 32)}
+		opts := []Option{PlaintextKeys()}
+		if hashed {
+			opts = []Option{HashKeys([]byte("secret"))}
+		}
+
+		// an existing plaintext record is only read while migrating
+		backend.Write(&store.Record{Key: "legacy", Value: []byte("plain")})
+
+		s := NewStore(backend, NewKeys("v1", keys), opts...)
+		expect := ErrNotEncrypted
+		if hashed {
+			expect = store.ErrNotFound
+		}
+		if _, err := s.Read("legacy"); err != expect {
+			t.Fatalf("expected %v, got %v", expect, err)
+		}
+
+		s = NewStore(backend, NewKeys("v1", keys), append(opts, Migrate())...)
+		if recs, err := s.Read("legacy"); err != nil || string(recs[0].Value) != "plain" {
+			t.Fatalf("unexpected legacy read %v %v", recs, err)
+		}
+
+		for _, key := range []string{"token/1", "token/2", "user/1"} {
+			if err := s.Write(&store.Record{Key: key, Value: []byte("secret " + key), Metadata: map[string]interface{}{"kind": "test"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		raw, _ := backend.List()
+		for _, k := range raw {
+			recs, err := backend.Read(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(recs[0].Value, []byte("secret")) {
+				t.Fatalf("value of %s stored in the clear", k)
+			}
+			if hashed && k != "legacy" && bytes.Contains([]byte(k), []byte("token")) {
+				t.Fatalf("key %s stored in the clear", k)
+			}
+		}
+
+		recs, err := s.Read("token/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recs[0].Key != "token/1" || string(recs[0].Value) != "secret token/1" || recs[0].Metadata["kind"] != "test" {
+			t.Fatalf("unexpected record %+v", recs[0])
+		}
+		if _, ok := recs[0].Metadata[MetadataKeyID]; ok {
+			t.Fatal("expected the key id to be hidden")
+		}
+
+		recs, err = s.Read("token/", store.ReadPrefix(), store.ReadLimit(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]string{}
+		for _, r := range recs {
+			values[r.Key] = string(r.Value)
+		}
+		if !reflect.DeepEqual(values, map[string]string{"token/1": "secret token/1", "token/2": "secret token/2"}) {
+			t.Fatalf("unexpected records %v", values)
+		}
+
+		list, err := s.List(store.ListSuffix("/1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(list)
+		if !reflect.DeepEqual(list, []string{"token/1", "user/1"}) {
+			t.Fatalf("unexpected keys %v", list)
+		}
+
+		// rotate to a new key, old values can still be read and
+		// Reencrypt migrates without being asked to
+		keys["v2"] = bytes.Repeat([]byte("b"), 32)
+		s = NewStore(backend, NewKeys("v2", keys), opts...)
+
+		if recs, err := s.Read("user/1"); err != nil || string(recs[0].Value) != "secret user/1" {
+			t.Fatalf("unexpected read after rotation %v %v", recs, err)
+		}
+
+		n, err := Reencrypt(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 4 {
+			t.Fatalf("expected 4 records re-encrypted, got %d", n)
+		}
+
+		// the old key is no longer needed
+		delete(keys, "v1")
+		s = NewStore(backend, NewKeys("v2", keys), opts...)
+
+		for _, key := range []string{"legacy", "token/1", "token/2", "user/1"} {
+			recs, err := s.Read(key)
+			if err != nil {
+				t.Fatalf("%s: %v", key, err)
+			}
+			if recs[0].Key != key {
+				t.Fatalf("unexpected key %s", recs[0].Key)
+			}
+		}
+
+		if n, _ := Reencrypt(s); n != 0 {
+			t.Fatalf("expected nothing to re-encrypt, got %d", n)
+		}
+
+		if err := s.Delete("token/1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Read("token/1"); err != store.ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+}
+
+func TestEncryptKeyMode(t *testing.T) {
+	keys := NewKeys("v1", map[string][]byte{"v1": bytes.Repeat([]byte("a"), 32)})
+	s := NewStore(store.NewMemoryStore(), keys)
+
+	if err := s.Write(&store.Record{Key: "foo"}); err != ErrNoKeyMode {
+		t.Fatalf("expected ErrNoKeyMode, got %v", err)
+	}
+	if _, err := s.Read("foo"); err != ErrNoKeyMode {
+		t.Fatalf("expected ErrNoKeyMode, got %v", err)
+	}
+	if _, err := Reencrypt(s); err != ErrNoKeyMode {
+		t.Fatalf("expected ErrNoKeyMode, got %v", err)
+	}
+}
+
+func TestEncryptConformance(t *testing.T) {
+	keys := NewKeys("v1", map[string][]byte{"v1": bytes.Repeat([]byte("a"), 32)})
+
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.NewMemoryStore(), keys, PlaintextKeys())
+	})
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.NewMemoryStore(), keys, HashKeys([]byte("secret")))
+	})
+}
@@ -0,0 +1,60 @@
+package encrypt
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrKeyNotFound = errors.New("encryption key not found")
+)
+
+// KeyProvider supplies the keys values are encrypted with. Keys are 16, 24
+// or 32 bytes for AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// Current returns the key new values are encrypted with
+	Current() (id string, key []byte, err error)
+	// Key returns an older key to decrypt with
+	Key(id string) ([]byte, error)
+}
+
+type staticKeys struct {
+	sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeys returns a KeyProvider over a fixed set of keys, encrypting with
+// the key current
+func NewKeys(current string, keys map[string][]byte) KeyProvider {
+	k := &staticKeys{
+		current: current,
+		keys:    make(map[string][]byte),
+	}
+	for id, key := range keys {
+		k.keys[id] = key
+	}
+	return k
+}
+
+func (k *staticKeys) Current() (string, []byte, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	key, ok := k.keys[k.current]
+	if !ok {
+		return "", nil, ErrKeyNotFound
+	}
+	return k.current, key, nil
+}
+
+func (k *staticKeys) Key(id string) ([]byte, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
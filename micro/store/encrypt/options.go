@@ -0,0 +1,39 @@
+package encrypt
+
+type Options struct {
+	// HashKey turns on hashed record keys
+	HashKey []byte
+	// PlaintextKeys stores record keys as they are
+	PlaintextKeys bool
+	// Migrate returns records which aren't encrypted as they are
+	Migrate bool
+}
+
+type Option func(o *Options)
+
+// HashKeys stores the HMAC-SHA256 of every record key instead of the key
+// itself, the key is kept encrypted in the metadata. Reads by key stay
+// cheap but prefix and suffix lookups have to decrypt every key in the
+// table. The secret has to stay the same when rotating keys.
+func HashKeys(secret []byte) Option {
+	return func(o *Options) {
+		o.HashKey = secret
+	}
+}
+
+// PlaintextKeys stores record keys in the clear, so only values are
+// encrypted. Either this or HashKeys has to be set.
+func PlaintextKeys() Option {
+	return func(o *Options) {
+		o.PlaintextKeys = true
+	}
+}
+
+// Migrate reads records written before the store was encrypted as they
+// are instead of failing with ErrNotEncrypted, until Reencrypt has
+// rewritten them
+func Migrate() Option {
+	return func(o *Options) {
+		o.Migrate = true
+	}
+}
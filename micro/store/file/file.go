@@ -0,0 +1,501 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wxc/micro/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	DefaultDatabase = "micro"
+	DefaultTable    = "micro"
+	DefaultDir      = filepath.Join(os.TempDir(), "micro", "store")
+	// OpenTimeout is how long to wait for another store holding the file
+	OpenTimeout = time.Millisecond * 100
+)
+
+type fileStore struct {
+	options store.Options
+	path    string
+
+	sync.Mutex
+	db *bolt.DB
+}
+
+// record is how a store.Record is kept in a bucket
+type record struct {
+	Key       string                 `json:"key"`
+	Value     []byte                 `json:"value"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	ExpiresAt time.Time              `json:"expires_at,omitempty"`
+	Version   uint64                 `json:"version,omitempty"`
+}
+
+func (r *record) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+func (r *record) toStore() *store.Record {
+	rec := &store.Record{
+		Key:      r.Key,
+		Value:    r.Value,
+		Metadata: make(map[string]interface{}),
+	}
+
+	for k, v := range r.Metadata {
+		rec.Metadata[k] = v
+	}
+	rec.Metadata[store.VersionKey] = r.Version
+
+	if !r.ExpiresAt.IsZero() {
+		rec.Expiry = time.Until(r.ExpiresAt)
+	}
+
+	return rec
+}
+
+func (f *fileStore) init(opts ...store.Option) error {
+	for _, o := range opts {
+		o(&f.options)
+	}
+
+	if len(f.options.Database) == 0 {
+		f.options.Database = DefaultDatabase
+	}
+	if len(f.options.Table) == 0 {
+		f.options.Table = DefaultTable
+	}
+
+	// each default database and table gets a file of its own, as a
+	// file can only be opened by one store at a time
+	dir := DefaultDir
+	if d, ok := f.options.Context.Value(dirKey{}).(string); ok && len(d) > 0 {
+		dir = d
+	}
+	path := filepath.Join(dir, url.PathEscape(f.options.Database), url.PathEscape(f.options.Table)+".db")
+	if len(f.options.Nodes) > 0 && len(f.options.Nodes[0]) > 0 {
+		path = f.options.Nodes[0]
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	// reopen on the next call if the file moved
+	if f.db != nil && path != f.path {
+		if err := f.db.Close(); err != nil {
+			return err
+		}
+		f.db = nil
+	}
+	f.path = path
+
+	return nil
+}
+
+func (f *fileStore) getDB() (*bolt.DB, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.db != nil {
+		return f.db, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(f.path, 0600, &bolt.Options{Timeout: OpenTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("store/file: %s is in use by another store", f.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.db = db
+	return db, nil
+}
+
+func (f *fileStore) names(database, table string) ([]byte, []byte) {
+	if len(database) == 0 {
+		database = f.options.Database
+	}
+	if len(table) == 0 {
+		table = f.options.Table
+	}
+	return []byte(database), []byte(table)
+}
+
+// bucket returns the table bucket inside the database bucket
+func bucket(tx *bolt.Tx, database, table []byte) *bolt.Bucket {
+	db := tx.Bucket(database)
+	if db == nil {
+		return nil
+	}
+	return db.Bucket(table)
+}
+
+// current returns the version of the live record at key, if any
+func current(b *bolt.Bucket, key string) (uint64, bool, error) {
+	if b == nil {
+		return 0, false, nil
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return 0, false, nil
+	}
+	r := new(record)
+	if err := json.Unmarshal(v, r); err != nil {
+		return 0, false, err
+	}
+	if r.expired(time.Now()) {
+		return 0, false, nil
+	}
+	return r.Version, true, nil
+}
+
+// check fails with ErrConflict unless the record at key matches the
+// conditions, as the memory store does
+func check(b *bolt.Bucket, key string, ifVersion uint64, ifNotExists bool) error {
+	if ifVersion == 0 && !ifNotExists {
+		return nil
+	}
+	version, exists, err := current(b, key)
+	if err != nil {
+		return err
+	}
+	if ifNotExists && exists {
+		return store.ErrConflict
+	}
+	if ifVersion > 0 && (!exists || version != ifVersion) {
+		return store.ErrConflict
+	}
+	return nil
+}
+
+// scan walks the live records of a table in key order, starting at the
+// prefix or after the cursor. It returns the keys of expired records so
+// they can be purged.
+func scan(b *bolt.Bucket, prefix, suffix, cursor string, fn func(*record) bool) ([]string, error) {
+	after, err := store.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	start := prefix
+	if len(cursor) > 0 && after > start {
+		start = after
+	}
+
+	var expired []string
+	now := time.Now()
+	c := b.Cursor()
+
+	for k, v := c.Seek([]byte(start)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+		if len(cursor) > 0 && string(k) <= after {
+			continue
+		}
+		if !strings.HasSuffix(string(k), suffix) {
+			continue
+		}
+
+		r := new(record)
+		if err := json.Unmarshal(v, r); err != nil {
+			return nil, err
+		}
+
+		if r.expired(now) {
+			expired = append(expired, r.Key)
+			continue
+		}
+
+		if !fn(r) {
+			break
+		}
+	}
+
+	return expired, nil
+}
+
+// purge lazily deletes records found expired by a read
+func (f *fileStore) purge(db *bolt.DB, database, table []byte, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := bucket(tx, database, table)
+		if b == nil {
+			return nil
+		}
+
+		now := time.Now()
+		for _, k := range keys {
+			// it may have been rewritten since
+			v := b.Get([]byte(k))
+			if v == nil {
+				continue
+			}
+			r := new(record)
+			if err := json.Unmarshal(v, r); err != nil || !r.expired(now) {
+				continue
+			}
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f *fileStore) Init(opts ...store.Option) error {
+	return f.init(opts...)
+}
+
+func (f *fileStore) Options() store.Options {
+	return f.options
+}
+
+func (f *fileStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	readOpts := store.ReadOptions{}
+	for _, o := range opts {
+		o(&readOpts)
+	}
+
+	db, err := f.getDB()
+	if err != nil {
+		return nil, err
+	}
+
+	database, table := f.names(readOpts.Database, readOpts.Table)
+
+	var prefix, suffix string
+	switch {
+	case readOpts.Prefix && readOpts.Suffix:
+		prefix, suffix = key, key
+	case readOpts.Prefix:
+		prefix = key
+	case readOpts.Suffix:
+		suffix = key
+	}
+
+	var results []*store.Record
+	var expired []string
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, database, table)
+		if b == nil {
+			return nil
+		}
+
+		if !readOpts.Prefix && !readOpts.Suffix {
+			v := b.Get([]byte(key))
+			if v == nil {
+				return nil
+			}
+			r := new(record)
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			if r.expired(time.Now()) {
+				expired = append(expired, r.Key)
+				return nil
+			}
+			results = append(results, r.toStore())
+			return nil
+		}
+
+		var skipped uint
+		var err error
+		expired, err = scan(b, prefix, suffix, readOpts.Cursor, func(r *record) bool {
+			if skipped < readOpts.Offset {
+				skipped++
+				return true
+			}
+			results = append(results, r.toStore())
+			return readOpts.Limit == 0 || uint(len(results)) < readOpts.Limit
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.purge(db, database, table, expired); err != nil {
+		return nil, err
+	}
+
+	if !readOpts.Prefix && !readOpts.Suffix && len(results) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	return results, nil
+}
+
+func (f *fileStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	writeOpts := store.WriteOptions{}
+	for _, o := range opts {
+		o(&writeOpts)
+	}
+
+	db, err := f.getDB()
+	if err != nil {
+		return err
+	}
+
+	database, table := f.names(writeOpts.Database, writeOpts.Table)
+
+	rec := &record{
+		Key:      r.Key,
+		Value:    r.Value,
+		Metadata: make(map[string]interface{}),
+	}
+	for k, v := range r.Metadata {
+		rec.Metadata[k] = v
+	}
+	delete(rec.Metadata, store.VersionKey)
+
+	expiry := r.Expiry
+	if !writeOpts.Expiry.IsZero() {
+		expiry = time.Until(writeOpts.Expiry)
+	}
+	if writeOpts.TTL != 0 {
+		expiry = writeOpts.TTL
+	}
+	if expiry != 0 {
+		rec.ExpiresAt = time.Now().Add(expiry)
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		d, err := tx.CreateBucketIfNotExists(database)
+		if err != nil {
+			return err
+		}
+		b, err := d.CreateBucketIfNotExists(table)
+		if err != nil {
+			return err
+		}
+
+		if err := check(b, r.Key, writeOpts.IfVersion, writeOpts.IfNotExists); err != nil {
+			return err
+		}
+
+		// the bucket sequence only grows, so versions are never reused
+		if rec.Version, err = b.NextSequence(); err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(r.Key), v)
+	})
+}
+
+func (f *fileStore) Delete(key string, opts ...store.DeleteOption) error {
+	deleteOpts := store.DeleteOptions{}
+	for _, o := range opts {
+		o(&deleteOpts)
+	}
+
+	db, err := f.getDB()
+	if err != nil {
+		return err
+	}
+
+	database, table := f.names(deleteOpts.Database, deleteOpts.Table)
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b := bucket(tx, database, table)
+		if err := check(b, key, deleteOpts.IfVersion, false); err != nil {
+			return err
+		}
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (f *fileStore) List(opts ...store.ListOption) ([]string, error) {
+	listOpts := store.ListOptions{}
+	for _, o := range opts {
+		o(&listOpts)
+	}
+
+	db, err := f.getDB()
+	if err != nil {
+		return nil, err
+	}
+
+	database, table := f.names(listOpts.Database, listOpts.Table)
+
+	var keys []string
+	var expired []string
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, database, table)
+		if b == nil {
+			return nil
+		}
+
+		var skipped uint
+		var err error
+		expired, err = scan(b, listOpts.Prefix, listOpts.Suffix, listOpts.Cursor, func(r *record) bool {
+			if skipped < listOpts.Offset {
+				skipped++
+				return true
+			}
+			keys = append(keys, r.Key)
+			return listOpts.Limit == 0 || uint(len(keys)) < listOpts.Limit
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.purge(db, database, table, expired); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (f *fileStore) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.db == nil {
+		return nil
+	}
+
+	err := f.db.Close()
+	f.db = nil
+	return err
+}
+
+func (f *fileStore) String() string {
+	return "file"
+}
+
+func NewStore(opts ...store.Option) store.Store {
+	s := &fileStore{
+		options: store.Options{
+			Context: context.Background(),
+		},
+	}
+	s.init(opts...)
+	return s
+}
@@ -0,0 +1,193 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s := NewStore(store.Nodes(path))
+
+	for _, key := range []string{"foo", "foobar", "foobaz", "barfoo", "bazfoo"} {
+		rec := &store.Record{
+			Key:      key,
+			Value:    []byte("value-" + key),
+			Metadata: map[string]interface{}{"key": key},
+		}
+		if err := s.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recs, err := s.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || string(recs[0].Value) != "value-foo" || recs[0].Metadata["key"] != "foo" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+
+	if _, err := s.Read("missing"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		opts   []store.ReadOption
+		key    string
+		expect []string
+	}{
+		{"prefix", []store.ReadOption{store.ReadPrefix()}, "foo", []string{"foo", "foobar", "foobaz"}},
+		{"suffix", []store.ReadOption{store.ReadSuffix()}, "foo", []string{"barfoo", "bazfoo", "foo"}},
+		{"limit", []store.ReadOption{store.ReadPrefix(), store.ReadLimit(2)}, "foo", []string{"foo", "foobar"}},
+		{"offset", []store.ReadOption{store.ReadPrefix(), store.ReadOffset(1)}, "foo", []string{"foobar", "foobaz"}},
+		{"page", []store.ReadOption{store.ReadSuffix(), store.ReadOffset(1), store.ReadLimit(1)}, "foo", []string{"bazfoo"}},
+	}
+
+	for _, tc := range testCases {
+		recs, err := s.Read(tc.key, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range recs {
+			keys = append(keys, r.Key)
+		}
+		if !reflect.DeepEqual(keys, tc.expect) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expect, keys)
+		}
+	}
+
+	keys, err := s.List(store.ListPrefix("ba"), store.ListLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"barfoo"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// tables are isolated from each other
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("other")}, store.WriteTo("other", "table")); err != nil {
+		t.Fatal(err)
+	}
+	recs, err = s.Read("foo", store.ReadFrom("other", "table"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recs[0].Value) != "other" {
+		t.Fatalf("unexpected value %s", recs[0].Value)
+	}
+	if keys, _ := s.List(store.ListFrom("other", "table")); len(keys) != 1 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if err := s.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// records survive reopening the file
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = NewStore(store.Nodes(path))
+	defer s.Close()
+
+	keys, err = s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"barfoo", "bazfoo", "foobar", "foobaz"}) {
+		t.Fatalf("unexpected keys after reopen %v", keys)
+	}
+}
+
+func TestFileStoreExpiry(t *testing.T) {
+	s := NewStore(WithDir(t.TempDir()))
+	defer s.Close()
+
+	if err := s.Write(&store.Record{Key: "ttl", Value: []byte("ttl")}, store.WriteTTL(time.Millisecond*50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "expiry", Value: []byte("expiry")}, store.WriteExpiry(time.Now().Add(time.Millisecond*50))); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "record", Value: []byte("record"), Expiry: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs[0].Expiry <= 0 || recs[0].Expiry > time.Hour {
+		t.Fatalf("unexpected expiry %v", recs[0].Expiry)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	if _, err := s.Read("ttl"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"record"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.Nodes(filepath.Join(t.TempDir(), "test.db")))
+	})
+}
+
+func BenchmarkFileStore(b *testing.B) {
+	test.Bench(b, func(t testing.TB) store.Store {
+		return NewStore(store.Nodes(filepath.Join(t.TempDir(), "bench.db")))
+	})
+}
+
+func TestFileStorePath(t *testing.T) {
+	dir := t.TempDir()
+
+	a := NewStore(WithDir(dir), store.Database("app"), store.Table("users"))
+	defer a.Close()
+	b := NewStore(WithDir(dir), store.Database("app"), store.Table("orders"))
+	defer b.Close()
+
+	// stores of different tables don't share a file
+	for _, s := range []store.Store{a, b} {
+		if err := s.Write(&store.Record{Key: "key", Value: []byte(s.Options().Table)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app", "users.db")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second store on the same file fails rather than hanging
+	c := NewStore(WithDir(dir), store.Database("app"), store.Table("users"))
+	defer c.Close()
+
+	start := time.Now()
+	if _, err := c.Read("key"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected the file to be in use, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("opening a file in use took too long")
+	}
+}
@@ -0,0 +1,20 @@
+package file
+
+import (
+	"context"
+
+	"github.com/wxc/micro/store"
+)
+
+type dirKey struct{}
+
+// WithDir sets the directory holding the store files, kept at
+// database/table.db. Nodes[0] may name the file itself instead.
+func WithDir(dir string) store.Option {
+	return func(o *store.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, dirKey{}, dir)
+	}
+}
@@ -5,18 +5,29 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/patrickmn/go-cache"
 )
 
+var (
+	// how many events a watcher may fall behind by
+	watchQueueSize = 1024
+	// how often expired records are looked for while watched
+	expireInterval = time.Second
+)
+
 func NewMemoryStore(opts ...Option) Store {
 	s := &memoryStore{
 		options: Options{
 			Database: "micro",
 			Table:    "micro",
 		},
-		store: cache.New(cache.NoExpiration, 5*time.Minute),
+		store:    cache.New(cache.NoExpiration, 5*time.Minute),
+		watchers: make(map[string]*memWatcher),
+		expiring: make(map[string]*storeRecord),
 	}
 	for _, o := range opts {
 		o(&s.options)
@@ -28,26 +39,46 @@ type memoryStore struct {
 	options Options
 
 	store *cache.Cache
+
+	// serializes writes so versions and events see a consistent store
+	mtx sync.Mutex
+	// the version of the last write
+	rev uint64
+	// records with an expiry by key while the store is watched, so an
+	// Expire event is sent even if the cache drops them first
+	expiring map[string]*storeRecord
+
+	sync.RWMutex
+	watchers map[string]*memWatcher
+	exit     chan bool
 }
 
 type storeRecord struct {
+	database  string
+	table     string
 	key       string
 	value     []byte
 	metadata  map[string]interface{}
 	expiresAt time.Time
+	version   uint64
 }
 
 func (m *memoryStore) key(prefix, key string) string {
 	return filepath.Join(prefix, key)
 }
 
-func (m *memoryStore) prefix(database, table string) string {
+func (m *memoryStore) names(database, table string) (string, string) {
 	if len(database) == 0 {
 		database = m.options.Database
 	}
 	if len(table) == 0 {
 		table = m.options.Table
 	}
+	return database, table
+}
+
+func (m *memoryStore) prefix(database, table string) string {
+	database, table = m.names(database, table)
 	return filepath.Join(database, table)
 }
 
@@ -79,37 +110,186 @@ func (m *memoryStore) get(prefix, key string) (*Record, error) {
 	for k, v := range storedRecord.metadata {
 		newRecord.Metadata[k] = v
 	}
+	newRecord.Metadata[VersionKey] = storedRecord.version
 
 	return newRecord, nil
 }
 
-func (m *memoryStore) set(prefix string, r *Record) {
+// version returns the version of a live record, m.mtx must be held
+func (m *memoryStore) version(database, table, key string) (uint64, bool) {
+	r, found := m.store.Get(m.key(m.prefix(database, table), key))
+	if !found {
+		return 0, false
+	}
+	i, ok := r.(*storeRecord)
+	if !ok {
+		return 0, false
+	}
+	return i.version, true
+}
+
+func (m *memoryStore) set(r *Record, opts WriteOptions) {
+	prefix := m.prefix(opts.Database, opts.Table)
 	key := m.key(prefix, r.Key)
 
+	m.expire(key)
+	_, exists := m.version(opts.Database, opts.Table, r.Key)
+
 	i := &storeRecord{}
+	i.database, i.table = m.names(opts.Database, opts.Table)
 	i.key = r.Key
 	i.value = make([]byte, len(r.Value))
 	i.metadata = make(map[string]interface{})
+	m.rev++
+	i.version = m.rev
 
 	copy(i.value, r.Value)
 
-	if r.Expiry != 0 {
-		i.expiresAt = time.Now().Add(r.Expiry)
+	expiry := r.Expiry
+	if !opts.Expiry.IsZero() {
+		expiry = time.Until(opts.Expiry)
+	}
+	if opts.TTL != 0 {
+		expiry = opts.TTL
+	}
+	delete(m.expiring, key)
+	if expiry != 0 {
+		i.expiresAt = time.Now().Add(expiry)
+		if m.watched() {
+			m.expiring[key] = i
+		}
 	}
 
 	for k, v := range r.Metadata {
 		i.metadata[k] = v
 	}
+	delete(i.metadata, VersionKey)
 
-	m.store.Set(key, i, r.Expiry)
+	m.store.Set(key, i, expiry)
+
+	typ := Create
+	if exists {
+		typ = Update
+	}
+	m.sendEvent(typ, i)
 }
 
-func (m *memoryStore) delete(prefix, key string) {
-	key = m.key(prefix, key)
+func (m *memoryStore) delete(database, table, key string) {
+	key = m.key(m.prefix(database, table), key)
+	m.expire(key)
+
+	r, found := m.store.Get(key)
 	m.store.Delete(key)
+	delete(m.expiring, key)
+
+	if i, ok := r.(*storeRecord); found && ok {
+		m.sendEvent(Delete, i)
+	}
+}
+
+// expire removes the record at key if it has expired and reports it,
+// m.mtx must be held
+func (m *memoryStore) expire(key string) {
+	i, ok := m.expiring[key]
+	if !ok || time.Now().Before(i.expiresAt) {
+		return
+	}
+	delete(m.expiring, key)
+	m.store.Delete(key)
+	m.sendEvent(Expire, i)
+}
+
+// watched reports whether anything is watching the store
+func (m *memoryStore) watched() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.watchers) > 0
 }
 
-func (m *memoryStore) list(prefix string, limit, offset uint) []string {
+// track starts or stops keeping expiring records to match whether the
+// store is watched, m.mtx must be held
+func (m *memoryStore) track() {
+	if !m.watched() {
+		m.expiring = make(map[string]*storeRecord)
+		return
+	}
+	for key, item := range m.store.Items() {
+		if i, ok := item.Object.(*storeRecord); ok && !i.expiresAt.IsZero() {
+			m.expiring[key] = i
+		}
+	}
+}
+
+// expireLoop reports records as they expire, it runs while the store
+// is watched
+func (m *memoryStore) expireLoop(interval time.Duration, exit chan bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-exit:
+			return
+		}
+
+		m.mtx.Lock()
+		for key := range m.expiring {
+			m.expire(key)
+		}
+		m.mtx.Unlock()
+	}
+}
+
+func (m *memoryStore) sendEvent(typ EventType, i *storeRecord) {
+	m.RLock()
+	watchers := make([]*memWatcher, 0, len(m.watchers))
+	for _, w := range m.watchers {
+		if w.match(i) {
+			watchers = append(watchers, w)
+		}
+	}
+	m.RUnlock()
+
+	if len(watchers) == 0 {
+		return
+	}
+
+	r := &Record{
+		Key:      i.key,
+		Value:    make([]byte, len(i.value)),
+		Metadata: make(map[string]interface{}),
+	}
+	copy(r.Value, i.value)
+	for k, v := range i.metadata {
+		r.Metadata[k] = v
+	}
+	r.Metadata[VersionKey] = i.version
+	if !i.expiresAt.IsZero() {
+		r.Expiry = time.Until(i.expiresAt)
+	}
+
+	e := &Event{
+		Timestamp: time.Now(),
+		Database:  i.database,
+		Table:     i.table,
+		Record:    r,
+		Type:      typ,
+	}
+
+	for _, w := range watchers {
+		w.push(e)
+	}
+}
+
+// list returns the keys in a database/table matching the filters in
+// key order, with the cursor, offset and limit applied after filtering
+func (m *memoryStore) list(prefix string, opts ListOptions) ([]string, error) {
+	after, err := DecodeCursor(opts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
 	allItems := m.store.Items()
 	foundKeys := make([]string, 0, len(allItems))
 
@@ -117,25 +297,43 @@ func (m *memoryStore) list(prefix string, limit, offset uint) []string {
 		if !strings.HasPrefix(k, prefix+"/") {
 			continue
 		}
-		foundKeys = append(foundKeys, strings.TrimPrefix(k, prefix+"/"))
-	}
+		k = strings.TrimPrefix(k, prefix+"/")
 
-	if limit != 0 || offset != 0 {
-		sort.Slice(foundKeys, func(i, j int) bool { return foundKeys[i] < foundKeys[j] })
-		min := func(i, j uint) uint {
-			if i < j {
-				return i
-			}
-			return j
+		if !strings.HasPrefix(k, opts.Prefix) || !strings.HasSuffix(k, opts.Suffix) {
+			continue
 		}
-		return foundKeys[offset:min(limit, uint(len(foundKeys)))]
+		if len(opts.Cursor) > 0 && k <= after {
+			continue
+		}
+		foundKeys = append(foundKeys, k)
+	}
+
+	sort.Strings(foundKeys)
+
+	if opts.Offset >= uint(len(foundKeys)) {
+		return nil, nil
+	}
+	foundKeys = foundKeys[opts.Offset:]
+
+	if opts.Limit > 0 && opts.Limit < uint(len(foundKeys)) {
+		foundKeys = foundKeys[:opts.Limit]
 	}
 
-	return foundKeys
+	return foundKeys, nil
 }
 
 func (m *memoryStore) Close() error {
+	m.Lock()
+	if m.exit != nil {
+		close(m.exit)
+		m.exit = nil
+	}
+	m.Unlock()
+
+	m.mtx.Lock()
 	m.store.Flush()
+	m.expiring = make(map[string]*storeRecord)
+	m.mtx.Unlock()
 	return nil
 }
 
@@ -160,32 +358,21 @@ func (m *memoryStore) Read(key string, opts ...ReadOption) ([]*Record, error) {
 
 	var keys []string
 	if readOpts.Prefix || readOpts.Suffix {
-		// 获取所有的key
-		k := m.list(prefix, 0, 0)
-		limit := int(readOpts.Limit)
-		offset := int(readOpts.Offset)
-
-		if limit > len(k) {
-			limit = len(k)
+		listOpts := ListOptions{
+			Cursor: readOpts.Cursor,
+			Limit:  readOpts.Limit,
+			Offset: readOpts.Offset,
 		}
-
-		if offset > len(k) {
-			offset = len(k)
+		if readOpts.Prefix {
+			listOpts.Prefix = key
+		}
+		if readOpts.Suffix {
+			listOpts.Suffix = key
 		}
 
-		for i := offset; i < limit; i++ {
-			kk := k[i]
-
-			// 过滤readOpts中设置的前缀
-			if readOpts.Prefix && !strings.HasPrefix(kk, key) {
-				continue
-			}
-
-			if readOpts.Suffix && !strings.HasSuffix(kk, key) {
-				continue
-			}
-
-			keys = append(keys, kk)
+		var err error
+		if keys, err = m.list(prefix, listOpts); err != nil {
+			return nil, err
 		}
 	} else {
 		keys = []string{key}
@@ -195,6 +382,10 @@ func (m *memoryStore) Read(key string, opts ...ReadOption) ([]*Record, error) {
 
 	for _, k := range keys {
 		r, err := m.get(prefix, k)
+		if err == ErrNotFound && (readOpts.Prefix || readOpts.Suffix) {
+			// expired since it was listed
+			continue
+		}
 		if err != nil {
 			return results, err
 		}
@@ -210,32 +401,15 @@ func (m *memoryStore) Write(r *Record, opts ...WriteOption) error {
 		o(&writeOpts)
 	}
 
-	prefix := m.prefix(writeOpts.Database, writeOpts.Table)
-
-	if len(opts) > 0 {
-		newRecord := Record{}
-		newRecord.Key = r.Key
-		newRecord.Value = make([]byte, len(r.Value))
-		newRecord.Metadata = make(map[string]interface{})
-		copy(newRecord.Value, r.Value)
-		newRecord.Expiry = r.Expiry
-
-		if !writeOpts.Expiry.IsZero() {
-			newRecord.Expiry = time.Until(writeOpts.Expiry)
-		}
-		if writeOpts.TTL != 0 {
-			newRecord.Expiry = writeOpts.TTL
-		}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
 
-		for k, v := range r.Metadata {
-			newRecord.Metadata[k] = v
-		}
-
-		m.set(prefix, &newRecord)
-		return nil
+	version, exists := m.version(writeOpts.Database, writeOpts.Table, r.Key)
+	if err := checkVersion(version, exists, writeOpts.IfVersion, writeOpts.IfNotExists); err != nil {
+		return err
 	}
 
-	m.set(prefix, r)
+	m.set(r, writeOpts)
 
 	return nil
 }
@@ -246,8 +420,66 @@ func (m *memoryStore) Delete(key string, opts ...DeleteOption) error {
 		o(&deleteOptions)
 	}
 
-	prefix := m.prefix(deleteOptions.Database, deleteOptions.Table)
-	m.delete(prefix, key)
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	version, exists := m.version(deleteOptions.Database, deleteOptions.Table, key)
+	if err := checkVersion(version, exists, deleteOptions.IfVersion, false); err != nil {
+		return err
+	}
+
+	m.delete(deleteOptions.Database, deleteOptions.Table, key)
+	return nil
+}
+
+func (m *memoryStore) Commit(txn *Txn) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	type state struct {
+		version uint64
+		exists  bool
+	}
+
+	// check every op against the store as the earlier ops leave it
+	pending := make(map[string]state)
+	rev := m.rev
+
+	for _, op := range txn.Ops {
+		database, table := op.WriteOptions.Database, op.WriteOptions.Table
+		if op.Record == nil {
+			database, table = op.DeleteOptions.Database, op.DeleteOptions.Table
+		}
+		key := m.key(m.prefix(database, table), op.Key)
+
+		st, ok := pending[key]
+		if !ok {
+			st.version, st.exists = m.version(database, table, op.Key)
+		}
+
+		if op.Record == nil {
+			if err := checkVersion(st.version, st.exists, op.DeleteOptions.IfVersion, false); err != nil {
+				return err
+			}
+			pending[key] = state{}
+			continue
+		}
+
+		if err := checkVersion(st.version, st.exists, op.WriteOptions.IfVersion, op.WriteOptions.IfNotExists); err != nil {
+			return err
+		}
+		rev++
+		pending[key] = state{version: rev, exists: true}
+	}
+
+	for _, op := range txn.Ops {
+		if op.Record == nil {
+			m.delete(op.DeleteOptions.Database, op.DeleteOptions.Table, op.Key)
+			continue
+		}
+		m.set(op.Record, op.WriteOptions)
+	}
+
 	return nil
 }
 
@@ -263,28 +495,40 @@ func (m *memoryStore) List(opts ...ListOption) ([]string, error) {
 	}
 
 	prefix := m.prefix(listOptions.Database, listOptions.Table)
-	// 获取对应dabatase/table下的所有key
-	keys := m.list(prefix, listOptions.Limit, listOptions.Offset)
-
-	if len(listOptions.Prefix) > 0 {
-		var prefixKeys []string
-		for _, k := range keys {
-			if strings.HasPrefix(k, listOptions.Prefix) {
-				prefixKeys = append(prefixKeys, k)
-			}
-		}
-		keys = prefixKeys
+	return m.list(prefix, listOptions)
+}
+
+func (m *memoryStore) Watch(opts ...WatchOption) (Watcher, error) {
+	var wo WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+	wo.Database, wo.Table = m.names(wo.Database, wo.Table)
+
+	w := &memWatcher{
+		exit:   make(chan bool),
+		notify: make(chan bool, 1),
+		size:   watchQueueSize,
+		id:     uuid.New().String(),
+		wo:     wo,
+		m:      m,
 	}
 
-	if len(listOptions.Suffix) > 0 {
-		var suffixKeys []string
-		for _, k := range keys {
-			if strings.HasSuffix(k, listOptions.Suffix) {
-				suffixKeys = append(suffixKeys, k)
-			}
-		}
-		keys = suffixKeys
+	m.Lock()
+	m.watchers[w.id] = w
+	first := m.exit == nil
+	if first {
+		m.exit = make(chan bool)
+		go m.expireLoop(expireInterval, m.exit)
+	}
+	m.Unlock()
+
+	// pick up the records written with a TTL before anything watched
+	if first {
+		m.mtx.Lock()
+		m.track()
+		m.mtx.Unlock()
 	}
 
-	return keys, nil
+	return w, nil
 }
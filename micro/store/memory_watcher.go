@@ -0,0 +1,108 @@
+package store
+
+import (
+	"strings"
+	"sync"
+)
+
+type memWatcher struct {
+	wo   WatchOptions
+	id   string
+	m    *memoryStore
+	exit chan bool
+	once sync.Once
+
+	// events queued for Next, notify is signalled on every push
+	mtx    sync.Mutex
+	queue  []*Event
+	size   int
+	err    error
+	notify chan bool
+}
+
+func (m *memWatcher) match(r *storeRecord) bool {
+	if m.wo.Database != r.database || m.wo.Table != r.table {
+		return false
+	}
+	if len(m.wo.Key) > 0 && m.wo.Key != r.key {
+		return false
+	}
+	return strings.HasPrefix(r.key, m.wo.Prefix)
+}
+
+// push queues an event without blocking the write. A watcher that falls
+// size events behind drops its queue and reports ErrWatcherOverflow
+// rather than silently missing events.
+func (m *memWatcher) push(e *Event) {
+	m.mtx.Lock()
+	switch {
+	case m.err != nil:
+		// dropping events until the overflow is read
+	case len(m.queue) >= m.size:
+		m.queue = nil
+		m.err = ErrWatcherOverflow
+	default:
+		m.queue = append(m.queue, e)
+	}
+	m.mtx.Unlock()
+
+	select {
+	case m.notify <- true:
+	default:
+	}
+}
+
+func (m *memWatcher) Next() (*Event, error) {
+	for {
+		select {
+		case <-m.exit:
+			return nil, ErrWatcherStopped
+		default:
+		}
+
+		m.mtx.Lock()
+		if len(m.queue) > 0 {
+			e := m.queue[0]
+			m.queue[0] = nil
+			m.queue = m.queue[1:]
+			m.mtx.Unlock()
+			return e, nil
+		}
+		// reported once, later events are queued again
+		err := m.err
+		m.err = nil
+		m.mtx.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-m.notify:
+		case <-m.exit:
+			return nil, ErrWatcherStopped
+		}
+	}
+}
+
+func (m *memWatcher) Stop() {
+	m.once.Do(func() {
+		close(m.exit)
+
+		m.m.Lock()
+		delete(m.m.watchers, m.id)
+		last := len(m.m.watchers) == 0 && m.m.exit != nil
+		if last {
+			close(m.m.exit)
+			m.m.exit = nil
+		}
+		m.m.Unlock()
+
+		// nothing is left to report expiries to
+		if last {
+			m.m.mtx.Lock()
+			m.m.track()
+			m.m.mtx.Unlock()
+		}
+	})
+}
@@ -19,10 +19,24 @@ func (n *noopStore) Read(key string, opts ...ReadOption) ([]*Record, error) {
 }
 
 func (n *noopStore) Write(r *Record, opts ...WriteOption) error {
+	var options WriteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.IfVersion > 0 || options.IfNotExists {
+		return ErrNotSupported
+	}
 	return nil
 }
 
 func (n *noopStore) Delete(key string, opts ...DeleteOption) error {
+	var options DeleteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.IfVersion > 0 {
+		return ErrNotSupported
+	}
 	return nil
 }
 
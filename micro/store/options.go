@@ -61,6 +61,8 @@ type ReadOptions struct {
 	Suffix          bool
 	Limit           uint
 	Offset          uint
+	// Cursor continues a prefix or suffix read after the key it was made from
+	Cursor string
 }
 
 type ReadOption func(r *ReadOptions)
@@ -96,10 +98,20 @@ func ReadOffset(o uint) ReadOption {
 	}
 }
 
+func ReadCursor(c string) ReadOption {
+	return func(r *ReadOptions) {
+		r.Cursor = c
+	}
+}
+
 type WriteOptions struct {
 	Database, Table string
 	Expiry          time.Time
 	TTL             time.Duration
+	// IfVersion only writes if the record is at this version
+	IfVersion uint64
+	// IfNotExists only writes if there is no record
+	IfNotExists bool
 }
 
 type WriteOption func(w *WriteOptions)
@@ -123,8 +135,25 @@ func WriteTTL(d time.Duration) WriteOption {
 	}
 }
 
+// WriteIfVersion fails the write with ErrConflict unless the record is
+// at version v. Stores which can't check it fail with ErrNotSupported.
+func WriteIfVersion(v uint64) WriteOption {
+	return func(w *WriteOptions) {
+		w.IfVersion = v
+	}
+}
+
+// WriteIfNotExists fails the write with ErrConflict if the record exists
+func WriteIfNotExists() WriteOption {
+	return func(w *WriteOptions) {
+		w.IfNotExists = true
+	}
+}
+
 type DeleteOptions struct {
 	Database, Table string
+	// IfVersion only deletes if the record is at this version
+	IfVersion uint64
 }
 
 type DeleteOption func(d *DeleteOptions)
@@ -136,12 +165,22 @@ func DeleteFrom(database, table string) DeleteOption {
 	}
 }
 
+// DeleteIfVersion fails the delete with ErrConflict unless the record is
+// at version v
+func DeleteIfVersion(v uint64) DeleteOption {
+	return func(d *DeleteOptions) {
+		d.IfVersion = v
+	}
+}
+
 type ListOptions struct {
 	Database, Table string
 	Prefix          string
 	Suffix          string
 	Limit           uint
 	Offset          uint
+	// Cursor continues a list after the key it was made from
+	Cursor string
 }
 
 type ListOption func(l *ListOptions)
@@ -176,3 +215,38 @@ func ListOffset(o uint) ListOption {
 		l.Offset = o
 	}
 }
+
+func ListCursor(c string) ListOption {
+	return func(l *ListOptions) {
+		l.Cursor = c
+	}
+}
+
+type WatchOptions struct {
+	Database, Table string
+	// Key watches a single key
+	Key string
+	// Prefix watches every key starting with it
+	Prefix string
+}
+
+type WatchOption func(w *WatchOptions)
+
+func WatchFrom(database, table string) WatchOption {
+	return func(w *WatchOptions) {
+		w.Database = database
+		w.Table = table
+	}
+}
+
+func WatchKey(k string) WatchOption {
+	return func(w *WatchOptions) {
+		w.Key = k
+	}
+}
+
+func WatchPrefix(p string) WatchOption {
+	return func(w *WatchOptions) {
+		w.Prefix = p
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ListResult is a page of keys, Cursor is empty on the last page
+type ListResult struct {
+	Keys   []string
+	Cursor string
+}
+
+// ReadResult is a page of records, Cursor is empty on the last page
+type ReadResult struct {
+	Records []*Record
+	Cursor  string
+}
+
+// EncodeCursor returns a cursor continuing after key. Cursors are opaque
+// to callers, stores decode them with DecodeCursor.
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeCursor returns the key a cursor continues after
+func DecodeCursor(c string) (string, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(b), nil
+}
+
+// ListPage lists a page of up to limit keys in key order, pass the
+// returned cursor with ListCursor to get the next page
+func ListPage(s Store, limit uint, opts ...ListOption) (*ListResult, error) {
+	// one more than asked for shows whether there is a next page
+	if limit > 0 {
+		opts = append(opts, ListLimit(limit+1))
+	}
+
+	keys, err := s.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ListResult{Keys: keys}
+	if limit > 0 && uint(len(keys)) > limit {
+		res.Keys = keys[:limit]
+		res.Cursor = EncodeCursor(keys[limit-1])
+	}
+	return res, nil
+}
+
+// ReadPage reads a page of up to limit records matching a prefix or
+// suffix read, pass the returned cursor with ReadCursor to get the next
+func ReadPage(s Store, key string, limit uint, opts ...ReadOption) (*ReadResult, error) {
+	if limit > 0 {
+		opts = append(opts, ReadLimit(limit+1))
+	}
+
+	recs, err := s.Read(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReadResult{Records: recs}
+	if limit > 0 && uint(len(recs)) > limit {
+		res.Records = recs[:limit]
+		res.Cursor = EncodeCursor(recs[limit-1].Key)
+	}
+	return res, nil
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	DefaultPollInterval = 5 * time.Second
+)
+
+// NewWatchStore returns a WatchStore for s. Stores that can't push their
+// changes are watched by polling them every interval.
+func NewWatchStore(s Store, interval time.Duration) WatchStore {
+	if w, ok := s.(WatchStore); ok {
+		return w
+	}
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &pollStore{Store: s, interval: interval}
+}
+
+type pollStore struct {
+	Store
+	interval time.Duration
+}
+
+type pollWatcher struct {
+	s    Store
+	wo   WatchOptions
+	res  chan *Event
+	exit chan bool
+	once sync.Once
+
+	// last seen records and when they were read
+	seen   map[string]*Record
+	seenAt map[string]time.Time
+}
+
+func (p *pollStore) Watch(opts ...WatchOption) (Watcher, error) {
+	var wo WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &pollWatcher{
+		s:    p.Store,
+		wo:   wo,
+		res:  make(chan *Event),
+		exit: make(chan bool),
+	}
+
+	// changes are reported from the first snapshot onwards
+	recs, err := w.read()
+	if err != nil {
+		return nil, err
+	}
+	w.seen, w.seenAt = w.index(recs)
+
+	go w.run(p.interval)
+
+	return w, nil
+}
+
+func (w *pollWatcher) read() ([]*Record, error) {
+	from := ReadFrom(w.wo.Database, w.wo.Table)
+
+	if len(w.wo.Key) > 0 {
+		recs, err := w.s.Read(w.wo.Key, from)
+		if err == ErrNotFound {
+			return nil, nil
+		}
+		return recs, err
+	}
+
+	return w.s.Read(w.wo.Prefix, from, ReadPrefix())
+}
+
+func (w *pollWatcher) index(recs []*Record) (map[string]*Record, map[string]time.Time) {
+	now := time.Now()
+	seen := make(map[string]*Record, len(recs))
+	seenAt := make(map[string]time.Time, len(recs))
+	for _, r := range recs {
+		seen[r.Key] = r
+		seenAt[r.Key] = now
+	}
+	return seen, seenAt
+}
+
+func (w *pollWatcher) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			recs, err := w.read()
+			if err != nil {
+				// try again on the next tick
+				continue
+			}
+			if !w.diff(recs) {
+				return
+			}
+		case <-w.exit:
+			return
+		}
+	}
+}
+
+// diff sends the events between the last snapshot and recs, it returns
+// false once the watcher is stopped.
+func (w *pollWatcher) diff(recs []*Record) bool {
+	seen, seenAt := w.index(recs)
+	var events []*Event
+
+	for key, r := range seen {
+		old, ok := w.seen[key]
+		switch {
+		case !ok:
+			events = append(events, w.event(Create, r))
+		case !bytes.Equal(old.Value, r.Value) || !reflect.DeepEqual(old.Metadata, r.Metadata):
+			events = append(events, w.event(Update, r))
+		}
+	}
+
+	for key, old := range w.seen {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		typ := Delete
+		if old.Expiry > 0 && !time.Now().Before(w.seenAt[key].Add(old.Expiry)) {
+			typ = Expire
+		}
+		events = append(events, w.event(typ, old))
+	}
+
+	w.seen, w.seenAt = seen, seenAt
+
+	for _, e := range events {
+		select {
+		case w.res <- e:
+		case <-w.exit:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *pollWatcher) event(typ EventType, r *Record) *Event {
+	return &Event{
+		Timestamp: time.Now(),
+		Database:  w.wo.Database,
+		Table:     w.wo.Table,
+		Record:    r,
+		Type:      typ,
+	}
+}
+
+func (w *pollWatcher) Next() (*Event, error) {
+	select {
+	case e := <-w.res:
+		return e, nil
+	case <-w.exit:
+		return nil, ErrWatcherStopped
+	}
+}
+
+func (w *pollWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+	})
+}
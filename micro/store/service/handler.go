@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	// DefaultBatchSize is how many keys are sent per message by ListStream
+	DefaultBatchSize = 100
+)
+
+// ListStream is the server side of a streaming list
+type ListStream interface {
+	Context() context.Context
+	Send(*ListResponse) error
+}
+
+// Handler serves a store.Store as the Store endpoints
+type Handler struct {
+	// Name is the id of the errors returned
+	Name  string
+	Store store.Store
+}
+
+func NewHandler(s store.Store) *Handler {
+	return &Handler{
+		Name:  DefaultService,
+		Store: s,
+	}
+}
+
+func (h *Handler) error(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case store.ErrNotFound:
+		return merr.NotFound(h.Name, err.Error())
+	case store.ErrConflict:
+		return merr.Conflict(h.Name, err.Error())
+	case store.ErrInvalidCursor:
+		return merr.BadRequest(h.Name, err.Error())
+	case store.ErrNotSupported:
+		return merr.New(h.Name, err.Error(), 501)
+	}
+	if _, ok := merr.As(err); ok {
+		return err
+	}
+	return merr.InternalServerError(h.Name, err.Error())
+}
+
+func (h *Handler) Read(ctx context.Context, req *ReadRequest, rsp *ReadResponse) error {
+	recs, err := h.Store.Read(req.Key, readOptions(req.Options)...)
+	if err != nil {
+		return h.error(err)
+	}
+	rsp.Records = recs
+	return nil
+}
+
+func (h *Handler) Write(ctx context.Context, req *WriteRequest, rsp *WriteResponse) error {
+	if req.Record == nil {
+		return merr.BadRequest(h.Name, "record is required")
+	}
+	return h.error(h.Store.Write(req.Record, writeOptions(req.Options)...))
+}
+
+func (h *Handler) Delete(ctx context.Context, req *DeleteRequest, rsp *DeleteResponse) error {
+	return h.error(h.Store.Delete(req.Key, deleteOptions(req.Options)...))
+}
+
+func (h *Handler) List(ctx context.Context, req *ListRequest, rsp *ListResponse) error {
+	keys, err := h.Store.List(listOptions(req.Options)...)
+	if err != nil {
+		return h.error(err)
+	}
+	rsp.Keys = keys
+	return nil
+}
+
+// ListStream sends the keys in batches of DefaultBatchSize
+func (h *Handler) ListStream(ctx context.Context, req *ListRequest, stream ListStream) error {
+	keys, err := h.Store.List(listOptions(req.Options)...)
+	if err != nil {
+		return h.error(err)
+	}
+
+	for len(keys) > 0 {
+		n := DefaultBatchSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+		if err := stream.Send(&ListResponse{Keys: keys[:n]}); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+
+	return nil
+}
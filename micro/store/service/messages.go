@@ -0,0 +1,110 @@
+package service
+
+import (
+	"time"
+
+	"github.com/wxc/micro/store"
+)
+
+type ReadRequest struct {
+	Key     string             `json:"key"`
+	Options *store.ReadOptions `json:"options,omitempty"`
+}
+
+type ReadResponse struct {
+	Records []*store.Record `json:"records"`
+}
+
+type WriteRequest struct {
+	Record  *store.Record       `json:"record"`
+	Options *store.WriteOptions `json:"options,omitempty"`
+}
+
+type WriteResponse struct{}
+
+type DeleteRequest struct {
+	Key     string               `json:"key"`
+	Options *store.DeleteOptions `json:"options,omitempty"`
+}
+
+type DeleteResponse struct{}
+
+type ListRequest struct {
+	Options *store.ListOptions `json:"options,omitempty"`
+}
+
+type ListResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// the options are sent as structs and turned back into options by the handler
+
+func readOptions(o *store.ReadOptions) []store.ReadOption {
+	if o == nil {
+		return nil
+	}
+	opts := []store.ReadOption{
+		store.ReadFrom(o.Database, o.Table),
+		store.ReadLimit(o.Limit),
+		store.ReadOffset(o.Offset),
+		store.ReadCursor(o.Cursor),
+	}
+	if o.Prefix {
+		opts = append(opts, store.ReadPrefix())
+	}
+	if o.Suffix {
+		opts = append(opts, store.ReadSuffix())
+	}
+	return opts
+}
+
+func writeOptions(o *store.WriteOptions) []store.WriteOption {
+	if o == nil {
+		return nil
+	}
+	opts := []store.WriteOption{
+		store.WriteTo(o.Database, o.Table),
+		store.WriteTTL(o.TTL),
+		store.WriteIfVersion(o.IfVersion),
+	}
+	if !o.Expiry.IsZero() {
+		opts = append(opts, store.WriteExpiry(o.Expiry))
+	}
+	if o.IfNotExists {
+		opts = append(opts, store.WriteIfNotExists())
+	}
+	return opts
+}
+
+func deleteOptions(o *store.DeleteOptions) []store.DeleteOption {
+	if o == nil {
+		return nil
+	}
+	return []store.DeleteOption{
+		store.DeleteFrom(o.Database, o.Table),
+		store.DeleteIfVersion(o.IfVersion),
+	}
+}
+
+func listOptions(o *store.ListOptions) []store.ListOption {
+	if o == nil {
+		return nil
+	}
+	return []store.ListOption{
+		store.ListFrom(o.Database, o.Table),
+		store.ListPrefix(o.Prefix),
+		store.ListSuffix(o.Suffix),
+		store.ListLimit(o.Limit),
+		store.ListOffset(o.Offset),
+		store.ListCursor(o.Cursor),
+	}
+}
+
+// expiry turns an absolute expiry into a TTL, clocks across the wire
+// can't be trusted to agree
+func expiry(o *store.WriteOptions) {
+	if !o.Expiry.IsZero() {
+		o.TTL = time.Until(o.Expiry)
+		o.Expiry = time.Time{}
+	}
+}
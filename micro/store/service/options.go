@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+
+	"github.com/wxc/micro/store"
+)
+
+type serviceKey struct{}
+
+// Service sets the name of the service serving the store
+func Service(name string) store.Option {
+	return func(o *store.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, serviceKey{}, name)
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/wxc/micro/client"
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	DefaultService = "go.micro.store"
+)
+
+type serviceStore struct {
+	options store.Options
+	service string
+}
+
+func (s *serviceStore) configure() {
+	s.service = DefaultService
+	if name, ok := s.options.Context.Value(serviceKey{}).(string); ok && len(name) > 0 {
+		s.service = name
+	}
+}
+
+func (s *serviceStore) client() client.Client {
+	if s.options.Client != nil {
+		return s.options.Client
+	}
+	return client.DefaultClient
+}
+
+func (s *serviceStore) context() context.Context {
+	if s.options.Context != nil {
+		return s.options.Context
+	}
+	return context.Background()
+}
+
+// callOptions sends requests straight to Nodes when they are set
+func (s *serviceStore) callOptions() []client.CallOption {
+	if len(s.options.Nodes) == 0 {
+		return nil
+	}
+	return []client.CallOption{client.WithAddress(s.options.Nodes...)}
+}
+
+func (s *serviceStore) call(endpoint string, req, rsp interface{}) error {
+	c := s.client()
+	r := c.NewRequest(s.service, endpoint, req)
+	return fromError(c.Call(s.context(), r, rsp, s.callOptions()...))
+}
+
+// fromError turns errors from the handler back into store errors
+func fromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	e := merr.FromError(err)
+	switch {
+	case e.Code == 404:
+		return store.ErrNotFound
+	case e.Code == 409:
+		return store.ErrConflict
+	case e.Code == 501:
+		return store.ErrNotSupported
+	case e.Code == 400 && e.Detail == store.ErrInvalidCursor.Error():
+		return store.ErrInvalidCursor
+	}
+	return err
+}
+
+func (s *serviceStore) names(database, table string) (string, string) {
+	if len(database) == 0 {
+		database = s.options.Database
+	}
+	if len(table) == 0 {
+		table = s.options.Table
+	}
+	return database, table
+}
+
+func (s *serviceStore) Init(opts ...store.Option) error {
+	for _, o := range opts {
+		o(&s.options)
+	}
+	s.configure()
+	return nil
+}
+
+func (s *serviceStore) Options() store.Options {
+	return s.options
+}
+
+func (s *serviceStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	var options store.ReadOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	options.Database, options.Table = s.names(options.Database, options.Table)
+
+	rsp := new(ReadResponse)
+	if err := s.call("Store.Read", &ReadRequest{Key: key, Options: &options}, rsp); err != nil {
+		return nil, err
+	}
+	return rsp.Records, nil
+}
+
+func (s *serviceStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	var options store.WriteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	options.Database, options.Table = s.names(options.Database, options.Table)
+	expiry(&options)
+
+	return s.call("Store.Write", &WriteRequest{Record: r, Options: &options}, new(WriteResponse))
+}
+
+func (s *serviceStore) Delete(key string, opts ...store.DeleteOption) error {
+	var options store.DeleteOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	options.Database, options.Table = s.names(options.Database, options.Table)
+
+	return s.call("Store.Delete", &DeleteRequest{Key: key, Options: &options}, new(DeleteResponse))
+}
+
+// List streams the keys so a large table isn't sent as one message
+func (s *serviceStore) List(opts ...store.ListOption) ([]string, error) {
+	var options store.ListOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	options.Database, options.Table = s.names(options.Database, options.Table)
+
+	req := &ListRequest{Options: &options}
+
+	c := s.client()
+	stream, err := c.Stream(s.context(), c.NewRequest(s.service, "Store.ListStream", req, client.StreamingRequest()), s.callOptions()...)
+	if err != nil {
+		return nil, fromError(err)
+	}
+	defer stream.Close()
+
+	if err := stream.Send(req); err != nil {
+		return nil, fromError(err)
+	}
+
+	var keys []string
+	for {
+		rsp := new(ListResponse)
+		err := stream.Recv(rsp)
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fromError(err)
+		}
+		keys = append(keys, rsp.Keys...)
+	}
+}
+
+func (s *serviceStore) Close() error {
+	return nil
+}
+
+func (s *serviceStore) String() string {
+	return "service"
+}
+
+// NewStore returns a store.Store served remotely by a Handler, it calls
+// the service through Options.Client
+func NewStore(opts ...store.Option) store.Store {
+	s := &serviceStore{
+		options: store.Options{
+			Context: context.Background(),
+		},
+	}
+	for _, o := range opts {
+		o(&s.options)
+	}
+	s.configure()
+	return s
+}
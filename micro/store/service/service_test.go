@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/client"
+	"github.com/wxc/micro/codec"
+	merr "github.com/wxc/micro/errors"
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+// testClient calls the handler directly, sending everything through json
+type testClient struct {
+	client.Client
+	h *Handler
+}
+
+type testRequest struct {
+	service, endpoint string
+	body              interface{}
+}
+
+func (r *testRequest) Service() string        { return r.service }
+func (r *testRequest) Method() string         { return r.endpoint }
+func (r *testRequest) Endpoint() string       { return r.endpoint }
+func (r *testRequest) ContentType() string    { return "application/json" }
+func (r *testRequest) Body() interface{}      { return r.body }
+func (r *testRequest) Codec() codec.Writer    { return nil }
+func (r *testRequest) Stream() bool           { return false }
+func (c *testClient) String() string          { return "test" }
+func (c *testClient) Options() client.Options { return client.Options{} }
+
+func roundTrip(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// wire turns handler errors into what a client would see
+func wire(err error) error {
+	if err == nil {
+		return nil
+	}
+	return merr.Parse(err.Error())
+}
+
+func (c *testClient) NewRequest(service, endpoint string, req interface{}, opts ...client.RequestOption) client.Request {
+	return &testRequest{service: service, endpoint: endpoint, body: req}
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	var err error
+
+	switch req.Endpoint() {
+	case "Store.Read":
+		in, out := new(ReadRequest), new(ReadResponse)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Read(ctx, in, out)
+		}
+		if err == nil {
+			err = roundTrip(out, rsp)
+		}
+	case "Store.Write":
+		in := new(WriteRequest)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Write(ctx, in, new(WriteResponse))
+		}
+	case "Store.Delete":
+		in := new(DeleteRequest)
+		if err = roundTrip(req.Body(), in); err == nil {
+			err = c.h.Delete(ctx, in, new(DeleteResponse))
+		}
+	default:
+		return fmt.Errorf("unknown endpoint %s", req.Endpoint())
+	}
+
+	return wire(err)
+}
+
+func (c *testClient) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	if req.Endpoint() != "Store.ListStream" {
+		return nil, fmt.Errorf("unknown endpoint %s", req.Endpoint())
+	}
+	return &testStream{ctx: ctx, h: c.h, rsp: make(chan []byte), done: make(chan error, 1)}, nil
+}
+
+type testStream struct {
+	client.Stream
+	ctx  context.Context
+	h    *Handler
+	rsp  chan []byte
+	done chan error
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+// serverStream is the handler's end of a testStream
+type serverStream struct {
+	*testStream
+}
+
+func (s serverStream) Send(rsp *ListResponse) error {
+	b, err := json.Marshal(rsp)
+	if err != nil {
+		return err
+	}
+	s.rsp <- b
+	return nil
+}
+
+func (s *testStream) Send(v interface{}) error {
+	req := new(ListRequest)
+	if err := roundTrip(v, req); err != nil {
+		return err
+	}
+	go func() {
+		s.done <- wire(s.h.ListStream(s.ctx, req, serverStream{s}))
+	}()
+	return nil
+}
+
+func (s *testStream) Recv(v interface{}) error {
+	select {
+	case b := <-s.rsp:
+		return json.Unmarshal(b, v)
+	case err := <-s.done:
+		if err == nil {
+			return io.EOF
+		}
+		return err
+	}
+}
+
+func (s *testStream) Close() error { return nil }
+
+func TestServiceStore(t *testing.T) {
+	batch := DefaultBatchSize
+	DefaultBatchSize = 2
+	defer func() { DefaultBatchSize = batch }()
+
+	backend := store.NewMemoryStore()
+	s := NewStore(store.WithClient(&testClient{h: NewHandler(backend)}), store.Database("remote"))
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if err := s.Write(&store.Record{Key: key, Value: []byte(key), Metadata: map[string]interface{}{"key": key}}, store.WriteExpiry(time.Now().Add(time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the data lives in the backend under the remote database
+	if _, err := backend.Read("a", store.ReadFrom("remote", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recs[0].Value) != "c" || recs[0].Metadata["key"] != "c" || recs[0].Expiry <= 0 {
+		t.Fatalf("unexpected record %+v", recs[0])
+	}
+
+	if _, err := s.Read("missing"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Write(&store.Record{Key: "a"}, store.WriteIfNotExists()); err != store.ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 {
+		t.Fatalf("expected 5 keys, got %v", keys)
+	}
+
+	keys, err = s.List(store.ListPrefix("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("a"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestServiceConformance(t *testing.T) {
+	test.Run(t, func(t testing.TB) store.Store {
+		return NewStore(store.WithClient(&testClient{h: NewHandler(store.NewMemoryStore())}))
+	})
+}
+
+func TestServiceNotSupported(t *testing.T) {
+	s := NewStore(store.WithClient(&testClient{h: NewHandler(store.NewNoopStore())}))
+
+	if err := s.Write(&store.Record{Key: "a"}, store.WriteIfNotExists()); err != store.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/store"
+)
+
+type driverKey struct{}
+type sweepIntervalKey struct{}
+
+// WithDriver sets the database/sql driver name, the driver itself has to
+// be imported by the caller. The DSN is taken from Nodes[0].
+func WithDriver(name string) store.Option {
+	return func(o *store.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, driverKey{}, name)
+	}
+}
+
+// SweepInterval sets how often expired rows are deleted.
+func SweepInterval(d time.Duration) store.Option {
+	return func(o *store.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, sweepIntervalKey{}, d)
+	}
+}
@@ -0,0 +1,654 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	dbsql "database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	DefaultDatabase      = "micro"
+	DefaultTable         = "micro"
+	DefaultDriver        = "sqlite3"
+	DefaultDSN           = "file:micro.db"
+	DefaultSweepInterval = time.Minute
+
+	ErrNotConnected = errors.New("store is not connected")
+	ErrKeyTooLong   = fmt.Errorf("key is longer than %d characters", MaxKeyLength)
+)
+
+const (
+	// MaxKeyLength is the size of the key column
+	MaxKeyLength = 255
+	// revisions holds the last version given out for each table, it
+	// can't clash with a table name which always starts t_ or h_
+	revisions = "micro_revisions"
+	// maxNameLength fits the identifier limits of postgres and mysql
+	maxNameLength = 63
+)
+
+// dialect covers what differs between the supported databases
+type dialect struct {
+	blob string
+	// collate makes keys compare and sort by byte
+	collate string
+	// postgres style $1 placeholders instead of ?
+	numbered bool
+}
+
+var dialects = map[string]dialect{
+	"postgres": {blob: "BYTEA", collate: `COLLATE "C"`, numbered: true},
+	"pgx":      {blob: "BYTEA", collate: `COLLATE "C"`, numbered: true},
+	"mysql":    {blob: "LONGBLOB", collate: "CHARACTER SET utf8mb4 COLLATE utf8mb4_bin"},
+	"sqlite3":  {blob: "BLOB"},
+	"sqlite":   {blob: "BLOB"},
+}
+
+type sqlStore struct {
+	options store.Options
+	driver  string
+	dialect dialect
+
+	sync.RWMutex
+	db     *dbsql.DB
+	tables map[string]bool
+	exit   chan bool
+}
+
+func (s *sqlStore) configure() error {
+	if len(s.options.Database) == 0 {
+		s.options.Database = DefaultDatabase
+	}
+	if len(s.options.Table) == 0 {
+		s.options.Table = DefaultTable
+	}
+
+	driver := DefaultDriver
+	if d, ok := s.options.Context.Value(driverKey{}).(string); ok && len(d) > 0 {
+		driver = d
+	}
+
+	dsn := DefaultDSN
+	if len(s.options.Nodes) > 0 && len(s.options.Nodes[0]) > 0 {
+		dsn = s.options.Nodes[0]
+	}
+
+	interval := DefaultSweepInterval
+	if d, ok := s.options.Context.Value(sweepIntervalKey{}).(time.Duration); ok && d > 0 {
+		interval = d
+	}
+
+	db, err := dbsql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	d, ok := dialects[driver]
+	if !ok {
+		d = dialects[DefaultDriver]
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.db != nil {
+		close(s.exit)
+		s.db.Close()
+	}
+
+	s.db = db
+	s.driver = driver
+	s.dialect = d
+	s.tables = make(map[string]bool)
+	s.exit = make(chan bool)
+
+	go s.sweep(db, d, interval, s.exit)
+
+	return nil
+}
+
+// sweep deletes expired rows from the tables this store has touched
+func (s *sqlStore) sweep(db *dbsql.DB, d dialect, interval time.Duration, exit chan bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.RLock()
+			var tables []string
+			for name := range s.tables {
+				tables = append(tables, name)
+			}
+			s.RUnlock()
+
+			for _, name := range tables {
+				query := d.rebind(fmt.Sprintf("DELETE FROM %s WHERE expiry > 0 AND expiry <= ?", name))
+				if _, err := db.Exec(query, time.Now().UnixNano()); err != nil {
+					logger.LoggerOrDefault(s.options.Logger).Logf(logger.ErrorLevel, "Failed to sweep %s: %v", name, err)
+				}
+			}
+		case <-exit:
+			return
+		}
+	}
+}
+
+// rebind turns ? placeholders into $n where the driver needs it
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// tableName maps a database/table pair to a table name so distinct pairs
+// never share a table. Every byte but a lower case letter or digit is
+// escaped as _xx, and the parts are joined by a double underscore, which
+// escaping never produces. Names too long for an identifier are hashed.
+func tableName(database, table string) string {
+	escape := func(s string) string {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+				b.WriteByte(c)
+				continue
+			}
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+		return b.String()
+	}
+
+	name := "t_" + escape(database) + "__" + escape(table)
+	if len(name) <= maxNameLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(database + "\x00" + table))
+	return "h_" + hex.EncodeToString(sum[:20])
+}
+
+// table returns the table for a database/table pair, creating it on first use
+func (s *sqlStore) table(database, table string) (*dbsql.DB, dialect, string, error) {
+	if len(database) == 0 {
+		database = s.options.Database
+	}
+	if len(table) == 0 {
+		table = s.options.Table
+	}
+
+	name := tableName(database, table)
+
+	s.RLock()
+	db := s.db
+	d := s.dialect
+	ok := s.tables[name]
+	s.RUnlock()
+
+	if db == nil {
+		return nil, d, "", ErrNotConnected
+	}
+
+	if ok {
+		return db, d, name, nil
+	}
+
+	// the unique reversed key doubles as the index for suffix reads, both
+	// use a binary collation so prefix ranges and ordering go by byte
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		record_key VARCHAR(%d) %s NOT NULL PRIMARY KEY,
+		reversed_key VARCHAR(%d) %s NOT NULL UNIQUE,
+		record_value %s,
+		metadata TEXT,
+		expiry BIGINT NOT NULL DEFAULT 0,
+		version BIGINT NOT NULL DEFAULT 0
+	)`, name, MaxKeyLength, d.collate, MaxKeyLength, d.collate, d.blob)
+
+	if _, err := db.Exec(query); err != nil {
+		return nil, d, "", err
+	}
+
+	// versions come from a counter per table rather than the rows, so a
+	// key written again after a delete never repeats one
+	query = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		table_name VARCHAR(%d) NOT NULL PRIMARY KEY,
+		revision BIGINT NOT NULL
+	)`, revisions, maxNameLength)
+
+	if _, err := db.Exec(query); err != nil {
+		return nil, d, "", err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (table_name, revision) SELECT ?, 0 WHERE NOT EXISTS (SELECT 1 FROM %s WHERE table_name = ?)", revisions, revisions)
+	if _, err := db.Exec(d.rebind(query), name, name); err != nil {
+		return nil, d, "", err
+	}
+
+	s.Lock()
+	s.tables[name] = true
+	s.Unlock()
+
+	return db, d, name, nil
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// upper returns the first key after every key starting with s, or an
+// empty string if there is none. Keys sort by code point, which is the
+// same as their UTF-8 bytes, so it bumps the last rune that can be.
+func upper(s string) string {
+	r := []rune(s)
+	for len(r) > 0 {
+		last := r[len(r)-1]
+		if last < utf8.MaxRune {
+			last++
+			// skip the surrogates which can't be encoded
+			if last >= 0xD800 && last <= 0xDFFF {
+				last = 0xE000
+			}
+			r[len(r)-1] = last
+			return string(r)
+		}
+		r = r[:len(r)-1]
+	}
+	return ""
+}
+
+// between matches the keys in column starting with prefix as a range,
+// unlike LIKE it is case sensitive everywhere and can use the index
+func between(column, prefix string) ([]string, []interface{}) {
+	clauses := []string{column + " >= ?"}
+	args := []interface{}{prefix}
+	if end := upper(prefix); len(end) > 0 {
+		clauses = append(clauses, column+" < ?")
+		args = append(args, end)
+	}
+	return clauses, args
+}
+
+// where builds the filter shared by Read and List, an empty prefix or
+// suffix matches every key
+func where(prefix, suffix, cursor string) (string, []interface{}, error) {
+	clauses := []string{"(expiry = 0 OR expiry > ?)"}
+	args := []interface{}{time.Now().UnixNano()}
+
+	if len(cursor) > 0 {
+		after, err := store.DecodeCursor(cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		clauses = append(clauses, "record_key > ?")
+		args = append(args, after)
+	}
+
+	if len(prefix) > 0 {
+		c, a := between("record_key", prefix)
+		clauses = append(clauses, c...)
+		args = append(args, a...)
+	}
+	if len(suffix) > 0 {
+		c, a := between("reversed_key", reverse(suffix))
+		clauses = append(clauses, c...)
+		args = append(args, a...)
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+func page(limit, offset uint) string {
+	switch {
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case offset > 0:
+		// an offset needs a limit in sqlite and mysql
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", int64(1<<62), offset)
+	default:
+		return ""
+	}
+}
+
+func (s *sqlStore) Init(opts ...store.Option) error {
+	for _, o := range opts {
+		o(&s.options)
+	}
+	return s.configure()
+}
+
+func (s *sqlStore) Options() store.Options {
+	return s.options
+}
+
+func (s *sqlStore) Read(key string, opts ...store.ReadOption) ([]*store.Record, error) {
+	readOpts := store.ReadOptions{}
+	for _, o := range opts {
+		o(&readOpts)
+	}
+
+	db, d, name, err := s.table(readOpts.Database, readOpts.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefix, suffix string
+	if readOpts.Prefix {
+		prefix = key
+	}
+	if readOpts.Suffix {
+		suffix = key
+	}
+
+	filter, args, err := where(prefix, suffix, readOpts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT record_key, record_value, metadata, expiry, version FROM %s WHERE %s", name, filter)
+
+	// a single key read has nothing to page over
+	if !readOpts.Prefix && !readOpts.Suffix {
+		query += " AND record_key = ?"
+		args = append(args, key)
+	} else {
+		query += " ORDER BY record_key" + page(readOpts.Limit, readOpts.Offset)
+	}
+
+	rows, err := db.Query(d.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*store.Record
+
+	for rows.Next() {
+		var metadata dbsql.NullString
+		var expiry int64
+		var version uint64
+		r := &store.Record{}
+
+		if err := rows.Scan(&r.Key, &r.Value, &metadata, &expiry, &version); err != nil {
+			return nil, err
+		}
+
+		if metadata.Valid && len(metadata.String) > 0 {
+			if err := json.Unmarshal([]byte(metadata.String), &r.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		if r.Metadata == nil {
+			r.Metadata = make(map[string]interface{})
+		}
+		r.Metadata[store.VersionKey] = version
+
+		if expiry > 0 {
+			r.Expiry = time.Until(time.Unix(0, expiry))
+		}
+
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !readOpts.Prefix && !readOpts.Suffix && len(records) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	return records, nil
+}
+
+func (s *sqlStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	writeOpts := store.WriteOptions{}
+	for _, o := range opts {
+		o(&writeOpts)
+	}
+
+	db, d, name, err := s.table(writeOpts.Database, writeOpts.Table)
+	if err != nil {
+		return err
+	}
+
+	// longer keys are rejected or truncated by some databases
+	if utf8.RuneCountInString(r.Key) > MaxKeyLength {
+		return ErrKeyTooLong
+	}
+
+	md := make(map[string]interface{}, len(r.Metadata))
+	for k, v := range r.Metadata {
+		md[k] = v
+	}
+	delete(md, store.VersionKey)
+
+	metadata, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	expiry := r.Expiry
+	if !writeOpts.Expiry.IsZero() {
+		expiry = time.Until(writeOpts.Expiry)
+	}
+	if writeOpts.TTL != 0 {
+		expiry = writeOpts.TTL
+	}
+
+	var expiresAt int64
+	if expiry != 0 {
+		expiresAt = time.Now().Add(expiry).UnixNano()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	version, err := s.next(tx, d, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// a conditional write updates the row only if it is still at the
+	// version, which the database checks atomically
+	if writeOpts.IfVersion > 0 {
+		query := fmt.Sprintf(`UPDATE %s SET record_value = ?, metadata = ?, expiry = ?, version = ?
+			WHERE record_key = ? AND version = ? AND (expiry = 0 OR expiry > ?)`, name)
+		res, err := tx.Exec(d.rebind(query), r.Value, string(metadata), expiresAt, version,
+			r.Key, writeOpts.IfVersion, time.Now().UnixNano())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			tx.Rollback()
+			if err != nil {
+				return err
+			}
+			return store.ErrConflict
+		}
+		return tx.Commit()
+	}
+
+	// an expired row no longer exists, otherwise delete and insert rather
+	// than rely on an upsert dialect
+	query := fmt.Sprintf("DELETE FROM %s WHERE record_key = ?", name)
+	args := []interface{}{r.Key}
+	if writeOpts.IfNotExists {
+		query += " AND expiry > 0 AND expiry <= ?"
+		args = append(args, time.Now().UnixNano())
+	}
+	if _, err := tx.Exec(d.rebind(query), args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (record_key, reversed_key, record_value, metadata, expiry, version) VALUES (?, ?, ?, ?, ?, ?)", name)
+	if _, err := tx.Exec(d.rebind(query), r.Key, reverse(r.Key), r.Value, string(metadata), expiresAt, version); err != nil {
+		tx.Rollback()
+		// the key is taken, by a row that was there or a concurrent write
+		if writeOpts.IfNotExists && s.exists(db, d, name, r.Key) {
+			return store.ErrConflict
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// next takes the next version of the table, holding the counter's row
+// until tx ends
+func (s *sqlStore) next(tx *dbsql.Tx, d dialect, name string) (uint64, error) {
+	query := fmt.Sprintf("UPDATE %s SET revision = revision + 1 WHERE table_name = ?", revisions)
+	if _, err := tx.Exec(d.rebind(query), name); err != nil {
+		return 0, err
+	}
+
+	var version uint64
+	query = fmt.Sprintf("SELECT revision FROM %s WHERE table_name = ?", revisions)
+	if err := tx.QueryRow(d.rebind(query), name).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (s *sqlStore) exists(db *dbsql.DB, d dialect, name, key string) bool {
+	var n int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE record_key = ?", name)
+	return db.QueryRow(d.rebind(query), key).Scan(&n) == nil && n > 0
+}
+
+func (s *sqlStore) Delete(key string, opts ...store.DeleteOption) error {
+	deleteOpts := store.DeleteOptions{}
+	for _, o := range opts {
+		o(&deleteOpts)
+	}
+
+	db, d, name, err := s.table(deleteOpts.Database, deleteOpts.Table)
+	if err != nil {
+		return err
+	}
+
+	if deleteOpts.IfVersion == 0 {
+		_, err = db.Exec(d.rebind(fmt.Sprintf("DELETE FROM %s WHERE record_key = ?", name)), key)
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE record_key = ? AND version = ? AND (expiry = 0 OR expiry > ?)", name)
+	res, err := db.Exec(d.rebind(query), key, deleteOpts.IfVersion, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return store.ErrConflict
+	}
+	return nil
+}
+
+func (s *sqlStore) List(opts ...store.ListOption) ([]string, error) {
+	listOpts := store.ListOptions{}
+	for _, o := range opts {
+		o(&listOpts)
+	}
+
+	db, d, name, err := s.table(listOpts.Database, listOpts.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, args, err := where(listOpts.Prefix, listOpts.Suffix, listOpts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT record_key FROM %s WHERE %s ORDER BY record_key", name, filter)
+	query += page(listOpts.Limit, listOpts.Offset)
+
+	rows, err := db.Query(d.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	close(s.exit)
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+func (s *sqlStore) String() string {
+	return "sql"
+}
+
+func NewStore(opts ...store.Option) store.Store {
+	s := &sqlStore{
+		options: store.Options{
+			Context: context.Background(),
+		},
+	}
+
+	for _, o := range opts {
+		o(&s.options)
+	}
+
+	if err := s.configure(); err != nil {
+		logger.LoggerOrDefault(s.options.Logger).Logf(logger.ErrorLevel, "Failed to open sql store: %v", err)
+	}
+
+	return s
+}
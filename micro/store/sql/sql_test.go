@@ -0,0 +1,223 @@
+package sql
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/wxc/micro/store"
+	"github.com/wxc/micro/store/test"
+)
+
+func newTestStore(t testing.TB, opts ...store.Option) store.Store {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db")
+	s := NewStore(append([]store.Option{store.Nodes(dsn)}, opts...)...)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, key := range []string{"foo", "foo_bar", "foo%baz", "barfoo", "bazfoo", "fooqux"} {
+		rec := &store.Record{
+			Key:      key,
+			Value:    []byte("value-" + key),
+			Metadata: map[string]interface{}{"key": key, "count": 1},
+		}
+		if err := s.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// overwrite an existing key
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("updated")}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || string(recs[0].Value) != "updated" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+
+	recs, err = s.Read("bazfoo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs[0].Metadata["key"] != "bazfoo" || recs[0].Metadata["count"] != float64(1) {
+		t.Fatalf("unexpected metadata %v", recs[0].Metadata)
+	}
+
+	if _, err := s.Read("missing"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		key    string
+		opts   []store.ReadOption
+		expect []string
+	}{
+		{"prefix", "foo", []store.ReadOption{store.ReadPrefix()}, []string{"foo", "foo%baz", "foo_bar", "fooqux"}},
+		{"escaped", "foo_", []store.ReadOption{store.ReadPrefix()}, []string{"foo_bar"}},
+		{"suffix", "foo", []store.ReadOption{store.ReadSuffix()}, []string{"barfoo", "bazfoo", "foo"}},
+		{"limit", "foo", []store.ReadOption{store.ReadPrefix(), store.ReadLimit(2)}, []string{"foo", "foo%baz"}},
+		{"offset", "foo", []store.ReadOption{store.ReadPrefix(), store.ReadOffset(3)}, []string{"fooqux"}},
+	}
+
+	for _, tc := range testCases {
+		recs, err := s.Read(tc.key, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range recs {
+			keys = append(keys, r.Key)
+		}
+		if !reflect.DeepEqual(keys, tc.expect) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expect, keys)
+		}
+	}
+
+	keys, err := s.List(store.ListSuffix("foo"), store.ListOffset(1), store.ListLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"bazfoo"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// each database and table pair gets its own table
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("other")}, store.WriteTo("other", "table")); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := s.List(store.ListFrom("other", "table")); !reflect.DeepEqual(keys, []string{"foo"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	if err := s.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Read("foo", store.ReadFrom("other", "table")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLStoreExpiry(t *testing.T) {
+	s := newTestStore(t, SweepInterval(time.Millisecond*50))
+
+	if err := s.Write(&store.Record{Key: "ttl", Value: []byte("ttl")}, store.WriteTTL(time.Millisecond*50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "record", Value: []byte("record"), Expiry: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs[0].Expiry <= 0 || recs[0].Expiry > time.Millisecond*50 {
+		t.Fatalf("unexpected expiry %v", recs[0].Expiry)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	if _, err := s.Read("ttl"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// the sweeper removes the row itself
+	ss := s.(*sqlStore)
+	time.Sleep(time.Millisecond * 100)
+
+	var count int
+	if err := ss.db.QueryRow("SELECT COUNT(*) FROM " + tableName(DefaultDatabase, DefaultTable)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 row after sweep, got %d", count)
+	}
+}
+
+func TestSQLStoreConformance(t *testing.T) {
+	test.Run(t, func(t testing.TB) store.Store {
+		return newTestStore(t)
+	})
+}
+
+func BenchmarkSQLStore(b *testing.B) {
+	test.Bench(b, func(t testing.TB) store.Store {
+		return newTestStore(t)
+	})
+}
+
+func TestSQLStoreTableNames(t *testing.T) {
+	s := newTestStore(t)
+
+	// pairs that would map to one table if underscores were left as is
+	pairs := [][2]string{{"foo", "bar_baz"}, {"foo_bar", "baz"}, {"Foo", "bar"}, {"foo", "bar"}}
+	for _, p := range pairs {
+		rec := &store.Record{Key: "key", Value: []byte(p[0] + "/" + p[1])}
+		if err := s.Write(rec, store.WriteTo(p[0], p[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range pairs {
+		recs, err := s.Read("key", store.ReadFrom(p[0], p[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := string(recs[0].Value); v != p[0]+"/"+p[1] {
+			t.Fatalf("%s/%s read %s", p[0], p[1], v)
+		}
+	}
+
+	long := strings.Repeat("x", 100)
+	if err := s.Write(&store.Record{Key: "key"}, store.WriteTo(long, long)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tableName(long, long)) > maxNameLength {
+		t.Fatalf("table name %s is too long", tableName(long, long))
+	}
+}
+
+func TestSQLStoreKeyLength(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.Write(&store.Record{Key: strings.Repeat("k", MaxKeyLength)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: strings.Repeat("k", MaxKeyLength+1)}); err != ErrKeyTooLong {
+		t.Fatalf("expected %v got %v", ErrKeyTooLong, err)
+	}
+}
+
+func TestUpper(t *testing.T) {
+	testData := []struct {
+		prefix string
+		expect string
+	}{
+		{"a", "b"},
+		{"A", "B"},
+		{"foo/", "foo0"},
+		{"a\U0010FFFF", "b"},
+		{"\U0010FFFF", ""},
+		{"a\uD7FF", "a\uE000"},
+	}
+
+	for _, d := range testData {
+		if got := upper(d.prefix); got != d.expect {
+			t.Fatalf("upper(%q): expected %q, got %q", d.prefix, d.expect, got)
+		}
+	}
+}
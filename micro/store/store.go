@@ -6,8 +6,12 @@ import (
 )
 
 var (
-	ErrNotFound        = errors.New("not found")
-	DefaultStore Store = NewStore()
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	// ErrNotSupported is returned by stores which can't honour an option,
+	// such as a conditional write, rather than ignoring it
+	ErrNotSupported       = errors.New("not supported")
+	DefaultStore    Store = NewStore()
 )
 
 type Store interface {
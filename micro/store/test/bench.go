@@ -0,0 +1,79 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wxc/micro/store"
+)
+
+// BenchSizes are the numbers of records Bench runs against
+var BenchSizes = []int{10, 100, 1000}
+
+// Bench benchmarks Read, Write and List on stores holding BenchSizes records
+func Bench(b *testing.B, newStore NewStore) {
+	for _, size := range BenchSizes {
+		b.Run(fmt.Sprintf("Write/%d", size), func(b *testing.B) {
+			s := newStore(b)
+			defer s.Close()
+
+			fill(b, s, size)
+			value := make([]byte, 128)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.Write(&store.Record{Key: key(i % size), Value: value}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Read/%d", size), func(b *testing.B) {
+			s := newStore(b)
+			defer s.Close()
+
+			fill(b, s, size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Read(key(i % size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("List/%d", size), func(b *testing.B) {
+			s := newStore(b)
+			defer s.Close()
+
+			fill(b, s, size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				keys, err := s.List()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(keys) != size {
+					b.Fatalf("expected %d keys, got %d", size, len(keys))
+				}
+			}
+		})
+	}
+}
+
+func key(i int) string {
+	return fmt.Sprintf("key-%06d", i)
+}
+
+func fill(b *testing.B, s store.Store, size int) {
+	value := make([]byte, 128)
+	for i := 0; i < size; i++ {
+		if err := s.Write(&store.Record{Key: key(i), Value: value}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
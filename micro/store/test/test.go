@@ -0,0 +1,636 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/store"
+)
+
+// NewStore returns an empty store for a single test or benchmark
+type NewStore func(t testing.TB) store.Store
+
+// Run runs the tests every store.Store implementation has to pass
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"ReadWriteDelete", testReadWriteDelete},
+		{"Ordering", testOrdering},
+		{"Pagination", testPagination},
+		{"Case", testCase},
+		{"Cursor", testCursor},
+		{"Expiry", testExpiry},
+		{"Isolation", testIsolation},
+		{"Metadata", testMetadata},
+		{"Concurrency", testConcurrency},
+		{"Conditional", testConditional},
+		{"ConditionalConcurrency", testConditionalConcurrency},
+		{"Close", testClose},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStore(t)
+			defer s.Close()
+			tc.fn(t, s)
+		})
+	}
+}
+
+func write(t testing.TB, s store.Store, keys ...string) {
+	t.Helper()
+	for _, k := range keys {
+		if err := s.Write(&store.Record{Key: k, Value: []byte(k)}); err != nil {
+			t.Fatalf("write %s: %v", k, err)
+		}
+	}
+}
+
+func recordKeys(recs []*store.Record) []string {
+	var keys []string
+	for _, r := range recs {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
+
+func expectKeys(t *testing.T, name string, expect, got []string) {
+	t.Helper()
+	if len(expect) == 0 && len(got) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Fatalf("%s: expected %v, got %v", name, expect, got)
+	}
+}
+
+func testReadWriteDelete(t *testing.T, s store.Store) {
+	if _, err := s.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	write(t, s, "foo")
+
+	recs, err := s.Read("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Key != "foo" || string(recs[0].Value) != "foo" {
+		t.Fatalf("unexpected records %v", recs)
+	}
+
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if recs, err := s.Read("foo"); err != nil || string(recs[0].Value) != "bar" {
+		t.Fatalf("expected overwritten value, got %v %v", recs, err)
+	}
+
+	if err := s.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("foo"); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Delete("foo"); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func testOrdering(t *testing.T, s store.Store) {
+	// written out of order on purpose
+	write(t, s, "b", "a/2", "c", "a/10", "a/1", "A")
+
+	all := []string{"A", "a/1", "a/10", "a/2", "b", "c"}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "list", all, keys)
+
+	recs, err := s.Read("a/", store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "read prefix", []string{"a/1", "a/10", "a/2"}, recordKeys(recs))
+}
+
+func testPagination(t *testing.T, s store.Store) {
+	write(t, s, "foo", "foobar", "foobaz", "barfoo", "bazfoo", "qux")
+
+	lists := []struct {
+		name   string
+		opts   []store.ListOption
+		expect []string
+	}{
+		{"all", nil, []string{"barfoo", "bazfoo", "foo", "foobar", "foobaz", "qux"}},
+		{"limit", []store.ListOption{store.ListLimit(2)}, []string{"barfoo", "bazfoo"}},
+		{"offset", []store.ListOption{store.ListOffset(4)}, []string{"foobaz", "qux"}},
+		{"limit offset", []store.ListOption{store.ListLimit(2), store.ListOffset(1)}, []string{"bazfoo", "foo"}},
+		{"offset past end", []store.ListOption{store.ListOffset(10)}, nil},
+		{"prefix", []store.ListOption{store.ListPrefix("foo")}, []string{"foo", "foobar", "foobaz"}},
+		{"prefix limit", []store.ListOption{store.ListPrefix("foo"), store.ListLimit(2)}, []string{"foo", "foobar"}},
+		{"prefix offset", []store.ListOption{store.ListPrefix("foo"), store.ListOffset(1)}, []string{"foobar", "foobaz"}},
+		{"suffix", []store.ListOption{store.ListSuffix("foo")}, []string{"barfoo", "bazfoo", "foo"}},
+		{"suffix limit offset", []store.ListOption{store.ListSuffix("foo"), store.ListOffset(1), store.ListLimit(1)}, []string{"bazfoo"}},
+		{"prefix suffix", []store.ListOption{store.ListPrefix("foo"), store.ListSuffix("baz")}, []string{"foobaz"}},
+	}
+
+	for _, tc := range lists {
+		keys, err := s.List(tc.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		expectKeys(t, "list "+tc.name, tc.expect, keys)
+	}
+
+	reads := []struct {
+		name   string
+		key    string
+		opts   []store.ReadOption
+		expect []string
+	}{
+		{"prefix", "foo", []store.ReadOption{store.ReadPrefix()}, []string{"foo", "foobar", "foobaz"}},
+		{"prefix limit", "foo", []store.ReadOption{store.ReadPrefix(), store.ReadLimit(2)}, []string{"foo", "foobar"}},
+		{"prefix offset", "foo", []store.ReadOption{store.ReadPrefix(), store.ReadOffset(2)}, []string{"foobaz"}},
+		{"suffix", "foo", []store.ReadOption{store.ReadSuffix()}, []string{"barfoo", "bazfoo", "foo"}},
+		{"suffix limit offset", "foo", []store.ReadOption{store.ReadSuffix(), store.ReadOffset(1), store.ReadLimit(1)}, []string{"bazfoo"}},
+		{"no match", "zzz", []store.ReadOption{store.ReadPrefix()}, nil},
+	}
+
+	for _, tc := range reads {
+		recs, err := s.Read(tc.key, tc.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		expectKeys(t, "read "+tc.name, tc.expect, recordKeys(recs))
+	}
+}
+
+func testCase(t *testing.T, s store.Store) {
+	// keys only differ by case and sort by byte
+	write(t, s, "apple", "b", "Apple", "APPLE")
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "list", []string{"APPLE", "Apple", "apple", "b"}, keys)
+
+	keys, err = s.List(store.ListPrefix("A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "list prefix", []string{"APPLE", "Apple"}, keys)
+
+	keys, err = s.List(store.ListSuffix("PLE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "list suffix", []string{"APPLE"}, keys)
+
+	recs, err := s.Read("a", store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "read prefix", []string{"apple"}, recordKeys(recs))
+
+	var pages []string
+	var cursor string
+	for {
+		res, err := store.ListPage(s, 1, store.ListPrefix("A"), store.ListCursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, res.Keys...)
+		if len(res.Cursor) == 0 {
+			break
+		}
+		cursor = res.Cursor
+	}
+	expectKeys(t, "list pages", []string{"APPLE", "Apple"}, pages)
+}
+
+func testCursor(t *testing.T, s store.Store) {
+	all := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6"}
+	write(t, s, all...)
+	write(t, s, "other")
+
+	var keys []string
+	var cursor string
+	pages := 0
+
+	for {
+		res, err := store.ListPage(s, 3, store.ListPrefix("k"), store.ListCursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		keys = append(keys, res.Keys...)
+		if len(res.Cursor) == 0 {
+			break
+		}
+		if pages > len(all) {
+			t.Fatal("cursor never ended")
+		}
+		cursor = res.Cursor
+	}
+
+	if pages != 3 {
+		t.Fatalf("expected 3 pages, got %d", pages)
+	}
+	expectKeys(t, "list pages", all, keys)
+
+	// a key written behind the cursor doesn't shift the next page
+	first, err := store.ListPage(s, 2, store.ListPrefix("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, s, "k00")
+	next, err := store.ListPage(s, 2, store.ListPrefix("k"), store.ListCursor(first.Cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "after write", []string{"k2", "k3"}, next.Keys)
+
+	var recs []*store.Record
+	cursor = ""
+	for {
+		res, err := store.ReadPage(s, "k", 4, store.ReadPrefix(), store.ReadCursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, res.Records...)
+		if len(res.Cursor) == 0 {
+			break
+		}
+		cursor = res.Cursor
+	}
+	expectKeys(t, "read pages", []string{"k0", "k00", "k1", "k2", "k3", "k4", "k5", "k6"}, recordKeys(recs))
+
+	if _, err := s.List(store.ListCursor("not a cursor!")); err != store.ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func testExpiry(t *testing.T, s store.Store) {
+	ttl := time.Millisecond * 100
+
+	writes := []struct {
+		key  string
+		rec  *store.Record
+		opts []store.WriteOption
+	}{
+		{"ttl", &store.Record{Key: "ttl"}, []store.WriteOption{store.WriteTTL(ttl)}},
+		{"expiry", &store.Record{Key: "expiry"}, []store.WriteOption{store.WriteExpiry(time.Now().Add(ttl))}},
+		{"record", &store.Record{Key: "record", Expiry: ttl}, nil},
+		// the option wins over the record
+		{"override", &store.Record{Key: "override", Expiry: time.Hour}, []store.WriteOption{store.WriteTTL(ttl)}},
+		{"forever", &store.Record{Key: "forever"}, nil},
+	}
+
+	for _, w := range writes {
+		w.rec.Value = []byte(w.key)
+		if err := s.Write(w.rec, w.opts...); err != nil {
+			t.Fatalf("write %s: %v", w.key, err)
+		}
+	}
+
+	for _, w := range writes {
+		recs, err := s.Read(w.key)
+		if err != nil {
+			t.Fatalf("read %s: %v", w.key, err)
+		}
+		if w.key == "forever" {
+			if recs[0].Expiry != 0 {
+				t.Fatalf("expected no expiry, got %v", recs[0].Expiry)
+			}
+			continue
+		}
+		if recs[0].Expiry <= 0 || recs[0].Expiry > ttl {
+			t.Fatalf("%s: expected an expiry within %v, got %v", w.key, ttl, recs[0].Expiry)
+		}
+	}
+
+	time.Sleep(ttl * 2)
+
+	for _, w := range writes[:4] {
+		if _, err := s.Read(w.key); err != store.ErrNotFound {
+			t.Fatalf("%s: expected ErrNotFound after expiry, got %v", w.key, err)
+		}
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "list after expiry", []string{"forever"}, keys)
+
+	recs, err := s.Read("", store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "read after expiry", []string{"forever"}, recordKeys(recs))
+}
+
+func testIsolation(t *testing.T, s store.Store) {
+	tables := [][2]string{{"db1", "t1"}, {"db1", "t2"}, {"db2", "t1"}}
+
+	for _, tb := range tables {
+		rec := &store.Record{Key: "key", Value: []byte(tb[0] + "." + tb[1])}
+		if err := s.Write(rec, store.WriteTo(tb[0], tb[1])); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(&store.Record{Key: tb[1], Value: []byte(tb[1])}, store.WriteTo(tb[0], tb[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tb := range tables {
+		recs, err := s.Read("key", store.ReadFrom(tb[0], tb[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(recs[0].Value) != tb[0]+"."+tb[1] {
+			t.Fatalf("%s.%s: unexpected value %s", tb[0], tb[1], recs[0].Value)
+		}
+
+		keys, err := s.List(store.ListFrom(tb[0], tb[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectKeys(t, tb[0]+"."+tb[1], []string{"key", tb[1]}, keys)
+	}
+
+	// nothing leaks into the default table
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeys(t, "default table", nil, keys)
+
+	if err := s.Delete("key", store.DeleteFrom("db1", "t1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read("key", store.ReadFrom("db1", "t1")); err != store.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Read("key", store.ReadFrom("db1", "t2")); err != nil {
+		t.Fatalf("delete leaked into another table: %v", err)
+	}
+}
+
+func testMetadata(t *testing.T, s store.Store) {
+	// values which survive being encoded as json
+	metadata := map[string]interface{}{
+		"string": "value",
+		"number": 1.5,
+		"bool":   true,
+	}
+
+	if err := s.Write(&store.Record{Key: "meta", Value: []byte{0, 1, 2, 255}, Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "empty"}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.Read("meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recs[0].Value, []byte{0, 1, 2, 255}) {
+		t.Fatalf("unexpected value %v", recs[0].Value)
+	}
+
+	got := make(map[string]interface{})
+	for k, v := range recs[0].Metadata {
+		got[k] = v
+	}
+	delete(got, store.VersionKey)
+	if !reflect.DeepEqual(got, metadata) {
+		t.Fatalf("expected metadata %v, got %v", metadata, got)
+	}
+
+	// changing what was written or read doesn't change the store
+	metadata["string"] = "changed"
+	recs[0].Metadata["string"] = "changed"
+	if recs, _ := s.Read("meta"); recs[0].Metadata["string"] != "value" {
+		t.Fatalf("stored metadata was changed to %v", recs[0].Metadata["string"])
+	}
+
+	recs, err = s.Read("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs[0].Value) != 0 {
+		t.Fatalf("expected an empty value, got %v", recs[0].Value)
+	}
+}
+
+func testConcurrency(t *testing.T, s store.Store) {
+	const writers, writes = 8, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				key := fmt.Sprintf("w%d-%02d", i, j)
+				if err := s.Write(&store.Record{Key: key, Value: []byte(key)}); err != nil {
+					errs <- err
+					return
+				}
+				if err := s.Write(&store.Record{Key: "shared", Value: []byte(key)}); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := s.Read(key); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	keys, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != writers*writes+1 {
+		t.Fatalf("expected %d keys, got %d", writers*writes+1, len(keys))
+	}
+
+	recs, err := s.Read("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last string
+	fmt.Sscanf(string(recs[0].Value), "w%s", &last)
+	if len(last) == 0 {
+		t.Fatalf("unexpected shared value %s", recs[0].Value)
+	}
+}
+
+func testClose(t *testing.T, s store.Store) {
+	write(t, s, "foo")
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing twice is harmless
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// conditional skips the test if the store can't do conditional writes
+func conditional(t *testing.T, err error) {
+	t.Helper()
+	if err == store.ErrNotSupported {
+		t.Skip("conditional writes are not supported")
+	}
+}
+
+func read(t *testing.T, s store.Store, key string) *store.Record {
+	t.Helper()
+	recs, err := s.Read(key)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return recs[0]
+}
+
+func testConditional(t *testing.T, s store.Store) {
+	err := s.Write(&store.Record{Key: "foo", Value: []byte("a")}, store.WriteIfNotExists())
+	conditional(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("b")}, store.WriteIfNotExists()); err != store.ErrConflict {
+		t.Fatalf("write if not exists over a record: expected ErrConflict, got %v", err)
+	}
+
+	v1 := store.Version(read(t, s, "foo"))
+	if v1 == 0 {
+		t.Fatal("record has no version")
+	}
+
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("b")}, store.WriteIfVersion(v1)); err != nil {
+		t.Fatal(err)
+	}
+	rec := read(t, s, "foo")
+	v2 := store.Version(rec)
+	if string(rec.Value) != "b" || v2 <= v1 {
+		t.Fatalf("expected b at a version above %d, got %s at %d", v1, rec.Value, v2)
+	}
+
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("c")}, store.WriteIfVersion(v1)); err != store.ErrConflict {
+		t.Fatalf("write at a stale version: expected ErrConflict, got %v", err)
+	}
+	if err := s.Write(&store.Record{Key: "bar", Value: []byte("c")}, store.WriteIfVersion(v1)); err != store.ErrConflict {
+		t.Fatalf("write at a version of a missing record: expected ErrConflict, got %v", err)
+	}
+	if err := s.Delete("foo", store.DeleteIfVersion(v1)); err != store.ErrConflict {
+		t.Fatalf("delete at a stale version: expected ErrConflict, got %v", err)
+	}
+	if err := s.Delete("foo", store.DeleteIfVersion(v2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a record written again after a delete never repeats a version
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("d")}, store.WriteIfNotExists()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&store.Record{Key: "foo", Value: []byte("e")}, store.WriteIfVersion(v2)); err != store.ErrConflict {
+		t.Fatalf("write at the version of a deleted record: expected ErrConflict, got %v", err)
+	}
+	if v3 := store.Version(read(t, s, "foo")); v3 <= v2 {
+		t.Fatalf("expected a version above %d, got %d", v2, v3)
+	}
+
+	// an expired record no longer exists
+	if err := s.Write(&store.Record{Key: "ttl", Value: []byte("a")}, store.WriteTTL(time.Millisecond*50)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if err := s.Write(&store.Record{Key: "ttl", Value: []byte("b")}, store.WriteIfNotExists()); err != nil {
+		t.Fatalf("write if not exists over an expired record: %v", err)
+	}
+
+	// metadata named like the version belongs to the caller
+	md := map[string]interface{}{"version": "v1.2.0"}
+	if err := s.Write(&store.Record{Key: "md", Value: []byte("a"), Metadata: md}); err != nil {
+		t.Fatal(err)
+	}
+	if v := read(t, s, "md").Metadata["version"]; v != "v1.2.0" {
+		t.Fatalf("expected version metadata v1.2.0, got %v", v)
+	}
+}
+
+// testConditionalConcurrency increments a counter from several writers,
+// no increment may be lost
+func testConditionalConcurrency(t *testing.T, s store.Store) {
+	err := s.Write(&store.Record{Key: "counter", Value: []byte("0")}, store.WriteIfNotExists())
+	conditional(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, increments = 4, 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				recs, err := s.Read("counter")
+				if err != nil {
+					errs <- err
+					return
+				}
+				v, _ := strconv.Atoi(string(recs[0].Value))
+				err = s.Write(&store.Record{Key: "counter", Value: []byte(strconv.Itoa(v + 1))},
+					store.WriteIfVersion(store.Version(recs[0])))
+				switch err {
+				case nil:
+					n++
+				case store.ErrConflict:
+				default:
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if v := string(read(t, s, "counter").Value); v != strconv.Itoa(writers*increments) {
+		t.Fatalf("expected %d, got %s", writers*increments, v)
+	}
+}
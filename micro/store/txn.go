@@ -0,0 +1,88 @@
+package store
+
+import (
+	"encoding/json"
+)
+
+// VersionKey is the metadata key holding the version of a record, it is
+// reserved and dropped from the metadata written. Every write to a table
+// gets a higher version than the last, so a record which is deleted or
+// expires and is written again never repeats one.
+const VersionKey = "micro.version"
+
+// TxnStore is a Store which can apply several writes and deletes at once
+type TxnStore interface {
+	Store
+	// Commit applies all of the ops or, on ErrConflict, none of them
+	Commit(txn *Txn) error
+}
+
+// Txn is a batch of writes and deletes, applied in order
+type Txn struct {
+	Ops []*TxnOp
+}
+
+// TxnOp is a write if Record is set, a delete of Key otherwise
+type TxnOp struct {
+	Key           string
+	Record        *Record
+	WriteOptions  WriteOptions
+	DeleteOptions DeleteOptions
+}
+
+func NewTxn() *Txn {
+	return &Txn{}
+}
+
+func (t *Txn) Write(r *Record, opts ...WriteOption) *Txn {
+	op := &TxnOp{Key: r.Key, Record: r}
+	for _, o := range opts {
+		o(&op.WriteOptions)
+	}
+	t.Ops = append(t.Ops, op)
+	return t
+}
+
+func (t *Txn) Delete(key string, opts ...DeleteOption) *Txn {
+	op := &TxnOp{Key: key}
+	for _, o := range opts {
+		o(&op.DeleteOptions)
+	}
+	t.Ops = append(t.Ops, op)
+	return t
+}
+
+// Version returns the version of a record read from a store, or 0 if it
+// has none
+func Version(r *Record) uint64 {
+	if r == nil {
+		return 0
+	}
+
+	// stores which encode metadata return it as a json number
+	switch v := r.Metadata[VersionKey].(type) {
+	case uint64:
+		return v
+	case int:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	case float64:
+		return uint64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return uint64(n)
+	default:
+		return 0
+	}
+}
+
+func checkVersion(current uint64, exists bool, ifVersion uint64, ifNotExists bool) error {
+	if ifNotExists && exists {
+		return ErrConflict
+	}
+	if ifVersion > 0 && (!exists || current != ifVersion) {
+		return ErrConflict
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteIfVersion(t *testing.T) {
+	s := NewMemoryStore()
+
+	if err := s.Write(&Record{Key: "leader", Value: []byte("a")}, WriteIfNotExists()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&Record{Key: "leader", Value: []byte("b")}, WriteIfNotExists()); err != ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	recs, err := s.Read("leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := Version(recs[0]); v != 1 {
+		t.Fatalf("expected version 1, got %d", v)
+	}
+
+	if err := s.Delete("leader", DeleteIfVersion(2)); err != ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if err := s.Delete("leader", DeleteIfVersion(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&Record{Key: "leader"}, WriteIfVersion(1)); err != ErrConflict {
+		t.Fatalf("expected ErrConflict for a missing record, got %v", err)
+	}
+
+	// concurrent increments only lose races, never updates
+	s.Write(&Record{Key: "counter", Value: []byte("0")})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; {
+				recs, err := s.Read("counter")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(string(recs[0].Value))
+				err = s.Write(&Record{Key: "counter", Value: []byte(strconv.Itoa(n + 1))}, WriteIfVersion(Version(recs[0])))
+				switch err {
+				case nil:
+					j++
+				case ErrConflict:
+				default:
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	recs, _ = s.Read("counter")
+	if string(recs[0].Value) != "100" {
+		t.Fatalf("unexpected counter %s at version %d", recs[0].Value, Version(recs[0]))
+	}
+}
+
+func TestCommit(t *testing.T) {
+	s := NewMemoryStore().(TxnStore)
+
+	s.Write(&Record{Key: "a", Value: []byte("a")})
+	s.Write(&Record{Key: "b", Value: []byte("b")})
+
+	err := s.Commit(NewTxn().
+		Write(&Record{Key: "a", Value: []byte("a2")}, WriteIfVersion(1)).
+		Delete("b").
+		Write(&Record{Key: "c", Value: []byte("c")}, WriteIfNotExists()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ := s.List()
+	if len(keys) != 2 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// the conflict on c leaves a untouched
+	err = s.Commit(NewTxn().
+		Write(&Record{Key: "a", Value: []byte("a3")}, WriteIfVersion(3)).
+		Write(&Record{Key: "c", Value: []byte("c2")}, WriteIfNotExists()))
+	if err != ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	recs, _ := s.Read("a")
+	if string(recs[0].Value) != "a2" || Version(recs[0]) != 3 {
+		t.Fatalf("unexpected record %s at version %d", recs[0].Value, Version(recs[0]))
+	}
+
+	// later ops see the earlier ones
+	err = s.Commit(NewTxn().
+		Write(&Record{Key: "d", Value: []byte("d")}, WriteIfNotExists()).
+		Write(&Record{Key: "d", Value: []byte("d2")}, WriteIfVersion(5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrWatcherStopped = errors.New("watcher stopped")
+	// ErrWatcherOverflow is returned once by a watcher which fell too far
+	// behind and dropped events. It keeps watching, the caller should read
+	// the store again.
+	ErrWatcherOverflow = errors.New("watcher fell behind")
+)
+
+// WatchStore is a Store which can push changes to its records
+type WatchStore interface {
+	Store
+	Watch(opts ...WatchOption) (Watcher, error)
+}
+
+type Watcher interface {
+	Next() (*Event, error)
+	Stop()
+}
+
+type EventType int
+
+const (
+	Create EventType = iota
+	Update
+	Delete
+	Expire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Create:
+		return "create"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	case Expire:
+		return "expire"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Timestamp time.Time
+	Database  string
+	Table     string
+	// Record is the last known value for delete and expire events
+	Record *Record
+	Type   EventType
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type watchCase struct {
+	typ   EventType
+	key   string
+	value string
+}
+
+func expectEvents(t *testing.T, w Watcher, expect []watchCase) {
+	t.Helper()
+
+	got := make(chan *Event)
+	go func() {
+		for {
+			e, err := w.Next()
+			if err != nil {
+				close(got)
+				return
+			}
+			got <- e
+		}
+	}()
+
+	for _, c := range expect {
+		select {
+		case e, ok := <-got:
+			if !ok {
+				t.Fatal("watcher stopped")
+			}
+			if e.Type != c.typ || e.Record.Key != c.key || string(e.Record.Value) != c.value {
+				t.Fatalf("expected %v %s=%s, got %v %s=%s", c.typ, c.key, c.value, e.Type, e.Record.Key, e.Record.Value)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("timed out waiting for %v %s", c.typ, c.key)
+		}
+	}
+
+	w.Stop()
+	for range got {
+	}
+}
+
+func TestMemoryWatch(t *testing.T) {
+	s := NewMemoryStore().(WatchStore)
+
+	w, err := s.Watch(WatchPrefix("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := s.Watch(WatchFrom("other", "table"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+
+	go func() {
+		s.Write(&Record{Key: "foo", Value: []byte("a")})
+		s.Write(&Record{Key: "bar", Value: []byte("skipped")})
+		s.Write(&Record{Key: "foo", Value: []byte("b")})
+		s.Delete("foo")
+		s.Delete("foo")
+		s.Write(&Record{Key: "foobar", Value: []byte("c")}, WriteTTL(time.Millisecond*10))
+		time.Sleep(time.Millisecond * 20)
+		// the expired record is purged by the delete
+		s.Delete("foobar")
+	}()
+
+	expectEvents(t, w, []watchCase{
+		{Create, "foo", "a"},
+		{Update, "foo", "b"},
+		{Delete, "foo", "b"},
+		{Create, "foobar", "c"},
+		{Expire, "foobar", "c"},
+	})
+
+	if _, err := w.Next(); err != ErrWatcherStopped {
+		t.Fatalf("expected ErrWatcherStopped, got %v", err)
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	// hide the Watch method of the memory store
+	s := NewWatchStore(struct{ Store }{NewMemoryStore()}, time.Millisecond*10)
+	if _, ok := s.(*pollStore); !ok {
+		t.Fatalf("expected a polling store, got %T", s)
+	}
+
+	s.Write(&Record{Key: "foo", Value: []byte("existing")})
+
+	w, err := s.Watch(WatchKey("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 30)
+		s.Write(&Record{Key: "foo", Value: []byte("a")}, WriteTTL(time.Millisecond*30))
+		time.Sleep(time.Millisecond * 100)
+		s.Write(&Record{Key: "foo", Value: []byte("b")})
+		time.Sleep(time.Millisecond * 30)
+		s.Delete("foo")
+	}()
+
+	expectEvents(t, w, []watchCase{
+		{Update, "foo", "a"},
+		{Expire, "foo", "a"},
+		{Create, "foo", "b"},
+		{Delete, "foo", "b"},
+	})
+}
+
+func TestMemoryWatchDelivery(t *testing.T) {
+	interval, size := expireInterval, watchQueueSize
+	expireInterval, watchQueueSize = time.Millisecond*10, 4
+	defer func() { expireInterval, watchQueueSize = interval, size }()
+
+	s := NewMemoryStore().(WatchStore)
+
+	// expired records are reported without another write, and before a
+	// write which replaces them
+	w, err := s.Watch(WatchPrefix("ttl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		s.Write(&Record{Key: "ttl", Value: []byte("a")}, WriteTTL(time.Millisecond*10))
+		time.Sleep(time.Millisecond * 100)
+		s.Write(&Record{Key: "ttl2", Value: []byte("b")}, WriteTTL(time.Millisecond*10))
+		time.Sleep(time.Millisecond * 20)
+		s.Write(&Record{Key: "ttl2", Value: []byte("c")})
+	}()
+	expectEvents(t, w, []watchCase{
+		{Create, "ttl", "a"},
+		{Expire, "ttl", "a"},
+		{Create, "ttl2", "b"},
+		{Expire, "ttl2", "b"},
+		{Create, "ttl2", "c"},
+	})
+
+	// a watcher which isn't read neither blocks writes nor silently
+	// drops events
+	slow, err := s.Watch(WatchPrefix("slow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := s.Write(&Record{Key: "slow", Value: []byte("x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > time.Millisecond*50 {
+		t.Fatal("writes were held up by the watcher")
+	}
+	if _, err := slow.Next(); err != ErrWatcherOverflow {
+		t.Fatalf("expected %v got %v", ErrWatcherOverflow, err)
+	}
+
+	// and carries on once the overflow is read
+	if err := s.Write(&Record{Key: "slow", Value: []byte("y")}); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := slow.Next(); err != nil || string(e.Record.Value) != "y" {
+		t.Fatalf("expected the next write got %v %v", e, err)
+	}
+
+	// stopped watchers are dropped straight away
+	slow.Stop()
+	m := s.(*memoryStore)
+	m.RLock()
+	n := len(m.watchers)
+	m.RUnlock()
+	if n != 0 {
+		t.Fatalf("expected no watchers got %d", n)
+	}
+}
+
+func TestMemoryWatchExpiring(t *testing.T) {
+	interval := expireInterval
+	expireInterval = time.Millisecond * 10
+	defer func() { expireInterval = interval }()
+
+	s := NewMemoryStore().(WatchStore)
+	m := s.(*memoryStore)
+
+	tracked := func() int {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		return len(m.expiring)
+	}
+
+	// nothing is kept for expiry events while the store isn't watched
+	for i := 0; i < 10; i++ {
+		s.Write(&Record{Key: fmt.Sprintf("key-%d", i), Value: []byte("a")}, WriteTTL(time.Hour))
+	}
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected no tracked records got %d", n)
+	}
+
+	// records written before the first watch are still reported
+	s.Write(&Record{Key: "ttl", Value: []byte("a")}, WriteTTL(time.Millisecond*50))
+	w, err := s.Watch(WatchPrefix("ttl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, w, []watchCase{
+		{Expire, "ttl", "a"},
+	})
+
+	w.Stop()
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected no tracked records after the last watcher stopped got %d", n)
+	}
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+)
+
+type Options struct {
+	Store store.Store
+	// Prefix is prepended to the keys written to the store
+	Prefix string
+	// RetryInterval is how often a held lock is tried again
+	RetryInterval time.Duration
+	Logger        logger.Logger
+}
+
+type Option func(o *Options)
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		Prefix:        DefaultPrefix,
+		RetryInterval: DefaultRetryInterval,
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if options.Store == nil {
+		options.Store = store.DefaultStore
+	}
+
+	return options
+}
+
+// WithStore sets the store, it has to support WriteIfNotExists,
+// WriteIfVersion and expiry, and the versions it gives a key must only
+// go up as they are used as fencing tokens
+func WithStore(s store.Store) Option {
+	return func(o *Options) {
+		o.Store = s
+	}
+}
+
+func Prefix(p string) Option {
+	return func(o *Options) {
+		o.Prefix = p
+	}
+}
+
+func RetryInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.RetryInterval = d
+	}
+}
+
+func WithLogger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+type LockOptions struct {
+	TTL time.Duration
+	// Wait is how long to wait for the lock, 0 waits forever
+	Wait time.Duration
+}
+
+type LockOption func(o *LockOptions)
+
+func LockTTL(t time.Duration) LockOption {
+	return func(o *LockOptions) {
+		o.TTL = t
+	}
+}
+
+func LockWait(t time.Duration) LockOption {
+	return func(o *LockOptions) {
+		o.Wait = t
+	}
+}
+
+type ElectOptions struct {
+	TTL time.Duration
+	// Context cancels a pending election
+	Context context.Context
+}
+
+type ElectOption func(o *ElectOptions)
+
+func ElectTTL(t time.Duration) ElectOption {
+	return func(o *ElectOptions) {
+		o.TTL = t
+	}
+}
+
+func ElectContext(ctx context.Context) ElectOption {
+	return func(o *ElectOptions) {
+		o.Context = ctx
+	}
+}
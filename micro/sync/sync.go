@@ -0,0 +1,372 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wxc/micro/logger"
+	"github.com/wxc/micro/store"
+)
+
+var (
+	DefaultPrefix        = "micro/sync/"
+	DefaultTTL           = 30 * time.Second
+	DefaultRetryInterval = 100 * time.Millisecond
+
+	ErrLockTimeout = errors.New("lock timeout")
+	ErrNotLocked   = errors.New("not locked")
+	ErrTTLTooShort = fmt.Errorf("ttl is shorter than %v", MinTTL)
+)
+
+// MinTTL is the shortest lock or leader TTL, leases are renewed every
+// third of it
+const MinTTL = 10 * time.Millisecond
+
+// Sync provides locks and leader election across the services sharing a store
+type Sync interface {
+	Init(...Option) error
+	Options() Options
+	// Lock blocks until the lock is held and returns its fencing token,
+	// it fails with store.ErrNotSupported if the store can't do
+	// conditional writes
+	Lock(id string, opts ...LockOption) (uint64, error)
+	Unlock(id string) error
+	// Elect blocks until this node is the leader for id
+	Elect(id string, opts ...ElectOption) (Leader, error)
+	String() string
+}
+
+type Leader interface {
+	ID() string
+	// Token is the fencing token of this term, it is larger than the
+	// token of every earlier leader
+	Token() uint64
+	// Status reports whether the lease is still held
+	Status() bool
+	// Revoked is closed when the lease is lost or resigned
+	Revoked() chan bool
+	Resign() error
+}
+
+type storeSync struct {
+	id string
+
+	mtx   gosync.RWMutex
+	opts  Options
+	locks map[string]*lease
+	// checked is the store last found to honour conditional writes
+	checked store.Store
+}
+
+// lease is a lock record kept alive until it is released or lost
+type lease struct {
+	s     *storeSync
+	id    string
+	key   string
+	value []byte
+	ttl   time.Duration
+	token uint64
+
+	gosync.Mutex
+	version uint64
+	renewed time.Time
+
+	revoked chan bool
+	once    gosync.Once
+}
+
+func (s *storeSync) options() Options {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.opts
+}
+
+// check makes sure the store fails conditional writes it can't honour,
+// a lock on a store that ignores them is no lock at all
+func (s *storeSync) check() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	st := s.opts.Store
+	if s.checked == st {
+		return nil
+	}
+
+	key := s.opts.Prefix + "probe/" + s.id
+	rec := &store.Record{Key: key, Value: []byte(s.id)}
+	if err := st.Write(rec, store.WriteIfNotExists(), store.WriteTTL(DefaultTTL)); err != nil {
+		return err
+	}
+	err := st.Write(rec, store.WriteIfNotExists(), store.WriteTTL(DefaultTTL))
+	st.Delete(key)
+	switch err {
+	case store.ErrConflict:
+	case nil:
+		return store.ErrNotSupported
+	default:
+		return err
+	}
+
+	s.checked = st
+	return nil
+}
+
+// acquire makes a single attempt at the lock record for name, it returns
+// store.ErrConflict if someone else holds it
+func (s *storeSync) acquire(id, name string, ttl time.Duration) (*lease, error) {
+	st := s.options().Store
+	key := s.options().Prefix + name
+	// each lease writes its own value so a record re-created by
+	// someone else after ours expired is never mistaken for ours
+	value := []byte(s.id + "/" + uuid.New().String())
+
+	if err := st.Write(&store.Record{Key: key, Value: value}, store.WriteIfNotExists(), store.WriteTTL(ttl)); err != nil {
+		return nil, err
+	}
+
+	recs, err := st.Read(key)
+	if err == store.ErrNotFound {
+		return nil, store.ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(recs[0].Value, value) {
+		return nil, store.ErrConflict
+	}
+
+	// the version the store gave the record when it was created is the
+	// token, versions of a key only go up even across deletes and expiry
+	version := store.Version(recs[0])
+	l := &lease{
+		s:       s,
+		id:      id,
+		key:     key,
+		value:   value,
+		ttl:     ttl,
+		token:   version,
+		version: version,
+		renewed: time.Now(),
+		revoked: make(chan bool),
+	}
+
+	go l.renew()
+
+	return l, nil
+}
+
+func (l *lease) renew() {
+	t := time.NewTicker(l.ttl / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-l.revoked:
+			return
+		}
+
+		l.Lock()
+		err := l.s.options().Store.Write(
+			&store.Record{Key: l.key, Value: l.value},
+			store.WriteIfVersion(l.version),
+			store.WriteTTL(l.ttl),
+		)
+		if err == nil {
+			err = l.refresh()
+		}
+		switch {
+		case err == nil:
+			l.renewed = time.Now()
+		case err == store.ErrConflict || time.Since(l.renewed) >= l.ttl:
+			// someone else holds it or it has expired by now
+			l.revoke()
+		default:
+			logger.LoggerOrDefault(l.s.options().Logger).Logf(logger.ErrorLevel, "Failed to renew lock %s: %v", l.id, err)
+		}
+		l.Unlock()
+	}
+}
+
+// refresh reads back the version of the lock record
+func (l *lease) refresh() error {
+	recs, err := l.s.options().Store.Read(l.key)
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(recs[0].Value, l.value) {
+		return store.ErrConflict
+	}
+	l.version = store.Version(recs[0])
+	return nil
+}
+
+func (l *lease) revoke() {
+	l.once.Do(func() {
+		close(l.revoked)
+	})
+}
+
+func (l *lease) release() error {
+	l.Lock()
+	defer l.Unlock()
+
+	select {
+	case <-l.revoked:
+		return nil
+	default:
+	}
+
+	l.revoke()
+
+	err := l.s.options().Store.Delete(l.key, store.DeleteIfVersion(l.version))
+	if err == store.ErrConflict {
+		// lost to someone else already
+		return nil
+	}
+	return err
+}
+
+func (l *lease) ID() string {
+	return l.id
+}
+
+func (l *lease) Token() uint64 {
+	return l.token
+}
+
+func (l *lease) Status() bool {
+	select {
+	case <-l.revoked:
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *lease) Revoked() chan bool {
+	return l.revoked
+}
+
+func (l *lease) Resign() error {
+	return l.release()
+}
+
+func (s *storeSync) Init(opts ...Option) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, o := range opts {
+		o(&s.opts)
+	}
+	return nil
+}
+
+func (s *storeSync) Options() Options {
+	return s.options()
+}
+
+func (s *storeSync) Lock(id string, opts ...LockOption) (uint64, error) {
+	options := LockOptions{TTL: DefaultTTL}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	ctx := context.Background()
+	if options.Wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Wait)
+		defer cancel()
+	}
+
+	l, err := s.wait(ctx, id, "lock/"+id, options.TTL)
+	if err == context.DeadlineExceeded {
+		return 0, ErrLockTimeout
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	s.mtx.Lock()
+	s.locks[id] = l
+	s.mtx.Unlock()
+
+	return l.token, nil
+}
+
+func (s *storeSync) Unlock(id string) error {
+	s.mtx.Lock()
+	l, ok := s.locks[id]
+	delete(s.locks, id)
+	s.mtx.Unlock()
+
+	if !ok {
+		return ErrNotLocked
+	}
+	return l.release()
+}
+
+func (s *storeSync) Elect(id string, opts ...ElectOption) (Leader, error) {
+	options := ElectOptions{
+		TTL:     DefaultTTL,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	l, err := s.wait(options.Context, id, "leader/"+id, options.TTL)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// wait retries acquire until it succeeds or ctx is done
+func (s *storeSync) wait(ctx context.Context, id, name string, ttl time.Duration) (*lease, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < MinTTL {
+		return nil, ErrTTLTooShort
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTicker(s.options().RetryInterval)
+	defer t.Stop()
+
+	for {
+		l, err := s.acquire(id, name, ttl)
+		if err != store.ErrConflict {
+			return l, err
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *storeSync) String() string {
+	return "store"
+}
+
+func NewSync(opts ...Option) Sync {
+	return &storeSync{
+		id:    uuid.New().String(),
+		opts:  NewOptions(opts...),
+		locks: make(map[string]*lease),
+	}
+}
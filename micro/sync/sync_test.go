@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wxc/micro/store"
+)
+
+func TestLock(t *testing.T) {
+	st := store.NewMemoryStore()
+	a := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+	b := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+
+	first, err := a.Lock("job", LockTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Lock("job", LockWait(time.Millisecond*50)); err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+
+	if err := b.Unlock("job"); err != ErrNotLocked {
+		t.Fatalf("expected ErrNotLocked, got %v", err)
+	}
+
+	// the lease outlives its ttl while it is renewed
+	time.Sleep(time.Millisecond * 1500)
+
+	done := make(chan uint64)
+	go func() {
+		token, err := b.Lock("job", LockTTL(time.Second), LockWait(time.Second*5))
+		if err != nil {
+			t.Error(err)
+		}
+		done <- token
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("lock acquired while held")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if err := a.Unlock("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	if second := <-done; second <= first {
+		t.Fatalf("expected a token above %d, got %d", first, second)
+	}
+	if err := b.Unlock("job"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestElect(t *testing.T) {
+	st := store.NewMemoryStore()
+	a := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+	b := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+
+	leader, err := a.Elect("cron", ElectTTL(time.Millisecond*300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !leader.Status() || leader.ID() != "cron" {
+		t.Fatalf("unexpected leader %s status %v", leader.ID(), leader.Status())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := b.Elect("cron", ElectContext(ctx)); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// losing the record to someone else revokes the lease
+	st.Delete(DefaultPrefix + "leader/cron")
+	next, err := b.Elect("cron", ElectTTL(time.Millisecond*300))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-leader.Revoked():
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not revoked")
+	}
+	if leader.Status() {
+		t.Fatal("expected the old leader to be revoked")
+	}
+	if next.Token() <= leader.Token() {
+		t.Fatalf("expected a token above %d, got %d", leader.Token(), next.Token())
+	}
+
+	if err := next.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	if next.Status() {
+		t.Fatal("expected resign to revoke the lease")
+	}
+	if _, err := st.Read(DefaultPrefix + "leader/cron"); err != store.ErrNotFound {
+		t.Fatalf("expected the record to be deleted, got %v", err)
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	st := store.NewMemoryStore()
+	a := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+	b := NewSync(WithStore(st), RetryInterval(time.Millisecond*10))
+
+	first, err := a.Lock("job", LockTTL(time.Millisecond*300))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a lost lease can't be told apart from an expired one, the next
+	// holder still gets a larger token
+	st.Delete(DefaultPrefix + "lock/job")
+	second, err := b.Lock("job", LockWait(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second <= first {
+		t.Fatalf("expected a token above %d, got %d", first, second)
+	}
+}
+
+func TestLockTTLTooShort(t *testing.T) {
+	s := NewSync(WithStore(store.NewMemoryStore()))
+
+	if _, err := s.Lock("job", LockTTL(1)); err != ErrTTLTooShort {
+		t.Fatalf("expected ErrTTLTooShort, got %v", err)
+	}
+	if _, err := s.Elect("cron", ElectTTL(time.Nanosecond*2)); err != ErrTTLTooShort {
+		t.Fatalf("expected ErrTTLTooShort, got %v", err)
+	}
+}
+
+// blindStore drops the conditions of every write
+type blindStore struct {
+	store.Store
+}
+
+func (b blindStore) Write(r *store.Record, opts ...store.WriteOption) error {
+	return b.Store.Write(r)
+}
+
+func TestLockNotSupported(t *testing.T) {
+	for _, st := range []store.Store{store.NewNoopStore(), blindStore{store.NewMemoryStore()}} {
+		s := NewSync(WithStore(st))
+		if _, err := s.Lock("job", LockWait(time.Millisecond*50)); err != store.ErrNotSupported {
+			t.Fatalf("%s: expected ErrNotSupported, got %v", st, err)
+		}
+		if _, err := s.Elect("cron"); err != store.ErrNotSupported {
+			t.Fatalf("%s: expected ErrNotSupported, got %v", st, err)
+		}
+	}
+}
@@ -23,6 +23,16 @@ const (
 	Target = "Micro-Target"
 	// ContentType header.
 	ContentType = "Content-Type"
+	// ContentEncoding header.
+	ContentEncoding = "Content-Encoding"
+	// Batch header holds the number of messages in a batched frame.
+	Batch = "Micro-Batch"
+	// PartitionKey header holds the ordering key of a message.
+	PartitionKey = "Micro-Partition-Key"
+	// ReplyTo header holds the topic a reply should be published to.
+	ReplyTo = "Micro-Reply-To"
+	// CorrelationID header matches a reply to its request.
+	CorrelationID = "Micro-Correlation-ID"
 	// SpanID header.
 	SpanID = "Micro-Span-ID"
 	// TraceIDKey header.